@@ -14,6 +14,9 @@ import (
 	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
 )
 
+// The file in the current directory that --backend fake keeps its fake foundation in, between runs
+const fakeStateFile = "fake-foundation.json"
+
 // CreateServicePush is the struct implementing the interface defined by the core CLI. It can
 // be found at  "code.cloudfoundry.org/cli/plugin/plugin.go"
 type CreateServicePush struct {
@@ -59,35 +62,67 @@ func (c *CreateServicePush) Run(cliConnection plugin.CliConnection, args []strin
 		c.Exit.HandleOK()
 	}
 
+	if CSPArguments.IsValidatingManifest {
+		c.validateManifest(cliConnection, CSPArguments)
+		return
+	}
+
+	var manifest *serviceManifest.ServiceManifest
+	report := NewReport(CSPArguments.ReportFormat, CSPArguments.ReportFile)
+	report.DryRun = CSPArguments.DryRun
+	options := serviceCreator.Options{
+		DryRun:           CSPArguments.DryRun,
+		Parallel:         CSPArguments.Parallel,
+		ServiceTimeout:   CSPArguments.ServiceTimeout,
+		PollInterval:     CSPArguments.PollInterval,
+		AllowPlanChanges: CSPArguments.AllowPlanChanges,
+		Prune:            CSPArguments.Prune,
+		PruneOwner:       CSPArguments.PruneOwner,
+		ConfirmPrune:     CSPArguments.ConfirmPrune,
+		KeepGoing:        CSPArguments.KeepGoing,
+		Retries:          CSPArguments.Retries,
+		WarnOnConflicts:  CSPArguments.WarnOnConflicts,
+		CheckMarketplace: !CSPArguments.SkipMarketplaceCheck,
+		Backend:          CSPArguments.Backend,
+		NoStart:          containsArgument(CSPArguments.OtherCFArgs, "--no-start"),
+	}
+	if CSPArguments.Backend == serviceCreator.BackendFake {
+		options.FakeStateFile = fakeStateFile
+	}
+
 	// If we are specified to process a service manifest (by default), then
 	// read in the service manifest and instantiate the services from that
 	if !CSPArguments.DoNotCreateServices {
 		p, err := c.Parser.CreateParser(CSPArguments.ServiceManifestFilename)
 
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			c.Exit.HandleError()
+			c.handleError(report, "ERROR", err)
 		}
 
-		manifest, err := p.Parser.Parse(CSPArguments.StaticVariablesFilePaths, CSPArguments.StaticVariables)
+		manifest, err = p.Parser.Parse(CSPArguments.StaticVariablesFilePaths, CSPArguments.StaticVariables)
 
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			c.Exit.HandleError()
+			c.handleError(report, "ERROR", err)
 		}
 
-		err = c.ServiceCreator.CreateServices(manifest, cliConnection)
+		err = c.ServiceCreator.CreateServices(manifest, cliConnection, options)
+		report.AddServiceResults(c.ServiceCreator.Results())
 
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			c.Exit.HandleError()
+			c.handleError(report, "ERROR", err)
 		}
 	}
 
 	// If no-push was specified, don't push the application. Otherwise, push the application
 	// to CF.
+	report.Push.Args = append([]string{}, CSPArguments.OtherCFArgs...)
 	if CSPArguments.DoNotPush {
 		fmt.Printf("--no-push applied: Your application will not be pushed to CF ...\n")
+	} else if CSPArguments.DryRun {
+		fmt.Printf("--dry-run applied: Would perform a CF Push with arguments [ %s ] ...\n", strings.Join(CSPArguments.OtherCFArgs, " "))
+		report.Push.Status = PushDryRun
+	} else if CSPArguments.Backend == serviceCreator.BackendFake {
+		fmt.Printf("--backend fake applied: Your application will not be pushed to CF ...\n")
 	} else {
 		var err error
 		// Perform the cf push
@@ -103,8 +138,8 @@ func (c *CreateServicePush) Run(cliConnection plugin.CliConnection, args []strin
 			// Search the current directory for the cf, if its not there, we'll search the $PATH
 			cwd, err := os.Getwd()
 			if err != nil {
-				fmt.Printf("ERROR while pushing: %s\n", err)
-				c.Exit.HandleError()
+				report.Push.Status, report.Push.Error = PushFailed, err.Error()
+				c.handleError(report, "ERROR while pushing", err)
 			}
 
 			var binaryFullPath = filepath.Join(cwd, "cf"+fileExtension)
@@ -115,8 +150,8 @@ func (c *CreateServicePush) Run(cliConnection plugin.CliConnection, args []strin
 				// if it doesn't exist, we'll look up the PATH variable instead.
 				binaryFullPath, lookupErr = exec.LookPath("cf" + fileExtension)
 				if lookupErr != nil {
-					fmt.Printf("ERROR while pushing: %s\n", lookupErr)
-					c.Exit.HandleError()
+					report.Push.Status, report.Push.Error = PushFailed, lookupErr.Error()
+					c.handleError(report, "ERROR while pushing", lookupErr)
 				}
 			}
 
@@ -135,10 +170,77 @@ func (c *CreateServicePush) Run(cliConnection plugin.CliConnection, args []strin
 		}
 
 		if err != nil {
-			fmt.Printf("ERROR while pushing: %s\n", err)
+			report.Push.Status, report.Push.Error = PushFailed, err.Error()
+			c.handleError(report, "ERROR while pushing", err)
+		} else {
+			report.Push.Status = PushSucceeded
+		}
+	}
+
+	// Now that the apps have been pushed, bind them to the services that list them in bind-to
+	if !CSPArguments.DoNotCreateServices {
+		err = c.ServiceCreator.BindServices(manifest, cliConnection, options)
+
+		if err != nil {
+			c.handleError(report, "ERROR while binding", err)
+		}
+	}
+
+	c.writeReport(report)
+}
+
+// validateManifest parses the service manifest, which checks it for problems, and optionally checks that the
+// marketplace of the targeted space offers its brokered services. Nothing is created or pushed.
+func (c *CreateServicePush) validateManifest(cliConnection plugin.CliConnection, CSPArguments *cspArguments.CSPArguments) {
+	p, err := c.Parser.CreateParser(CSPArguments.ServiceManifestFilename)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		c.Exit.HandleError()
+		return
+	}
+
+	manifest, err := p.Parser.Parse(CSPArguments.StaticVariablesFilePaths, CSPArguments.StaticVariables)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		c.Exit.HandleError()
+		return
+	}
+
+	if CSPArguments.CheckMarketplace {
+		fmt.Printf("Checking the marketplace of the targeted space ...\n")
+		if err = c.ServiceCreator.CheckMarketplace(manifest, cliConnection, serviceCreator.Options{Backend: CSPArguments.Backend, FakeStateFile: fakeStateFile}); err != nil {
+			fmt.Printf("ERROR: %s\n", err)
 			c.Exit.HandleError()
+			return
 		}
 	}
+
+	fmt.Printf("The service manifest %s is valid, with %d services\n", CSPArguments.ServiceManifestFilename, len(manifest.Services))
+}
+
+// handleError prints the error, adds it to the report and writes the report, before exiting with an error
+func (c *CreateServicePush) handleError(report *Report, prefix string, err error) {
+	fmt.Printf("%s: %s\n", prefix, err)
+	report.Error = err.Error()
+	c.writeReport(report)
+	c.Exit.HandleError()
+}
+
+// writeReport writes the report, if one was requested
+func (c *CreateServicePush) writeReport(report *Report) {
+	if err := report.Write(); err != nil {
+		fmt.Printf("ERROR while writing the report: %s\n", err)
+	}
+}
+
+// containsArgument returns true if the argument is in the list of arguments
+func containsArgument(args []string, argument string) bool {
+	for _, arg := range args {
+		if arg == argument {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *CreateServicePush) getAlias() string {
@@ -166,8 +268,8 @@ func (c *CreateServicePush) GetMetadata() plugin.PluginMetadata {
 		Name: "Create-Service-Push",
 		Version: plugin.VersionType{
 			Major: 1,
-			Minor: 3,
-			Build: 2,
+			Minor: 4,
+			Build: 0,
 		},
 		MinCliVersion: plugin.VersionType{
 			Major: 6,
@@ -187,6 +289,14 @@ func (c *CreateServicePush) GetMetadata() plugin.PluginMetadata {
 					Options: c.ArgProcessor.GetArgumentsDescription(),
 				},
 			},
+			{
+				Name:     "validate-service-manifest",
+				HelpText: "Checks a services-manifest.yml file for problems, without creating any services or pushing any applications.",
+				UsageDetails: plugin.Usage{
+					Usage:   c.ArgProcessor.GetValidateUsage(),
+					Options: c.ArgProcessor.GetValidateArgumentsDescription(),
+				},
+			},
 		},
 	}
 }
@@ -1,11 +1,18 @@
 package createServicePush_test
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	. "github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/createServicePush"
 	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/createServicePush/mock"
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceCreator"
 	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceCreator/mock"
 )
 
@@ -134,4 +141,184 @@ var _ = Describe("CreateServicePush", func() {
 		Expect(mockCreateServiceInterfaces.ServicesCreated).Should(BeTrue())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
+
+	It("create service should pass dry run to the service creator and not push when DryRun was true", func() {
+		mockCreateServiceInterfaces.DryRun = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+		Expect(mockCreateServiceInterfaces.ServicesCreated).Should(BeTrue())
+		Expect(mockCreateServiceInterfaces.CreateServicesOptions.DryRun).Should(BeTrue())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("create service should bind services after pushing", func() {
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+		Expect(mockCreateServiceInterfaces.ServicesBound).Should(BeTrue())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeTrue())
+	})
+
+	It("create service should fail if BindServices Failed", func() {
+		mockCreateServiceInterfaces.BindServiceHasError = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeTrue())
+	})
+
+	It("create service should not bind services if DoNotCreateServices was true", func() {
+		mockCreateServiceInterfaces.DoNotCreateServices = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+		Expect(mockCreateServiceInterfaces.ServicesBound).Should(BeFalse())
+	})
+
+	It("create service should write a JSON report of the services and the push when a report file was given", func() {
+		reportDir, err := ioutil.TempDir("", "csp-report")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(reportDir)
+
+		mockCreateServiceInterfaces.ReportFormat = "json"
+		mockCreateServiceInterfaces.ReportFile = filepath.Join(reportDir, "report.json")
+		mockCreateServiceInterfaces.CreateServicesResults = &serviceCreator.Results{Entries: []serviceCreator.Result{
+			{
+				ServiceName:              "MyService",
+				Action:                   serviceCreator.PlanCreate,
+				Status:                   serviceCreator.ResultSucceeded,
+				Duration:                 90 * time.Second,
+				LastOperationState:       "succeeded",
+				LastOperationDescription: "create succeeded",
+			},
+			{ServiceName: "MyOtherService", Action: serviceCreator.PlanSkip, Status: serviceCreator.ResultSucceeded},
+		}}
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+
+		report, err := ioutil.ReadFile(mockCreateServiceInterfaces.ReportFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(report).Should(MatchJSON(`{
+			"services": [
+				{"name": "MyService", "action": "created", "duration_seconds": 90,
+				 "last_operation": {"state": "succeeded", "description": "create succeeded"}},
+				{"name": "MyOtherService", "action": "skipped", "duration_seconds": 0,
+				 "last_operation": {"state": "", "description": ""}}
+			],
+			"push": {"status": "succeeded", "args": []}
+		}`))
+	})
+
+	It("create service should report the actions that would be taken on a dry run", func() {
+		reportDir, err := ioutil.TempDir("", "csp-report")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(reportDir)
+
+		mockCreateServiceInterfaces.ReportFormat = "json"
+		mockCreateServiceInterfaces.ReportFile = filepath.Join(reportDir, "report.json")
+		mockCreateServiceInterfaces.DryRun = true
+		mockCreateServiceInterfaces.CreateServicesResults = &serviceCreator.Results{Entries: []serviceCreator.Result{
+			{ServiceName: "MyService", Action: serviceCreator.PlanCreate, Status: serviceCreator.ResultSucceeded},
+			{ServiceName: "MyUpdatedService", Action: serviceCreator.PlanUpdate, Status: serviceCreator.ResultSucceeded},
+			{ServiceName: "MyOldService", Action: serviceCreator.PlanDelete, Status: serviceCreator.ResultSucceeded},
+			{ServiceName: "MyOtherService", Action: serviceCreator.PlanSkip, Status: serviceCreator.ResultSucceeded},
+		}}
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+
+		var report Report
+		rawReport, err := ioutil.ReadFile(mockCreateServiceInterfaces.ReportFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(json.Unmarshal(rawReport, &report)).Should(Succeed())
+		Expect(report.DryRun).Should(BeTrue())
+		Expect(report.Services[0].Action).Should(Equal("would-create"))
+		Expect(report.Services[1].Action).Should(Equal("would-update"))
+		Expect(report.Services[2].Action).Should(Equal("would-delete"))
+		Expect(report.Services[3].Action).Should(Equal("skipped"))
+		Expect(report.Push.Status).Should(Equal(PushDryRun))
+	})
+
+	It("create service should report the error and the failed services when services could not be created", func() {
+		reportDir, err := ioutil.TempDir("", "csp-report")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(reportDir)
+
+		mockCreateServiceInterfaces.ReportFile = filepath.Join(reportDir, "report.json")
+		mockCreateServiceInterfaces.ReportFormat = "json"
+		mockCreateServiceInterfaces.DoNotPush = true
+		mockCreateServiceInterfaces.CreateServiceHasError = true
+		mockCreateServiceInterfaces.CreateServicesResults = &serviceCreator.Results{Entries: []serviceCreator.Result{
+			{ServiceName: "MyService", Action: serviceCreator.PlanUpdate, Status: serviceCreator.ResultFailed, Message: "broker exploded"},
+		}}
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeTrue())
+
+		var report Report
+		rawReport, err := ioutil.ReadFile(mockCreateServiceInterfaces.ReportFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(json.Unmarshal(rawReport, &report)).Should(Succeed())
+		Expect(report.Error).Should(Equal("CreateServiceHasError = true"))
+		Expect(report.Services[0].Action).Should(Equal("failed"))
+		Expect(report.Services[0].Message).Should(Equal("broker exploded"))
+		Expect(report.Push.Status).Should(Equal(PushSkipped))
+	})
+
+	It("create service should pass keep going to the service creator and fail without pushing when services failed", func() {
+		mockCreateServiceInterfaces.KeepGoing = true
+		mockCreateServiceInterfaces.CreateServiceHasError = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockCreateServiceInterfaces.CreateServicesOptions.KeepGoing).Should(BeTrue())
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeTrue())
+	})
+
+	It("validate service manifest should parse the manifest without creating services or pushing", func() {
+		mockCreateServiceInterfaces.IsValidatingManifest = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+		Expect(mockCreateServiceInterfaces.ServicesCreated).Should(BeFalse())
+		Expect(mockCreateServiceInterfaces.MarketplaceChecked).Should(BeFalse())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("validate service manifest should fail if Parse Failed", func() {
+		mockCreateServiceInterfaces.IsValidatingManifest = true
+		mockCreateServiceInterfaces.ParseHasError = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeTrue())
+		Expect(mockCreateServiceInterfaces.MarketplaceChecked).Should(BeFalse())
+	})
+
+	It("validate service manifest should check the marketplace when asked to", func() {
+		mockCreateServiceInterfaces.IsValidatingManifest = true
+		mockCreateServiceInterfaces.CheckMarketplaceFlag = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+		Expect(mockCreateServiceInterfaces.MarketplaceChecked).Should(BeTrue())
+
+		mockCreateServiceInterfaces.MarketplaceHasError = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeTrue())
+	})
+
+	It("create service should check the marketplace before creating services unless it is skipped", func() {
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockCreateServiceInterfaces.CreateServicesOptions.CheckMarketplace).Should(BeTrue())
+
+		mockCreateServiceInterfaces.SkipMarketplaceCheck = true
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockCreateServiceInterfaces.CreateServicesOptions.CheckMarketplace).Should(BeFalse())
+	})
+
+	It("create service should pass the backend on to the service creator", func() {
+		mockCreateServiceInterfaces.Backend = "v3"
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockCreateServiceInterfaces.CreateServicesOptions.Backend).Should(Equal("v3"))
+	})
+
+	It("create service should use the fake foundation and not push the application with the fake backend", func() {
+		mockCreateServiceInterfaces.Backend = "fake"
+		mockCSP.Run(mockCFPlugin, []string{})
+		Expect(mockCreateServiceInterfaces.CreateServicesOptions.Backend).Should(Equal("fake"))
+		Expect(mockCreateServiceInterfaces.CreateServicesOptions.FakeStateFile).Should(Equal("fake-foundation.json"))
+		Expect(mockCreateServiceInterfaces.ServicesCreated).Should(BeTrue())
+		Expect(mockCreateServiceInterfaces.ServicesBound).Should(BeTrue())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+		Expect(mockExitHandler.Exit1WasCalled).Should(BeFalse())
+	})
 })
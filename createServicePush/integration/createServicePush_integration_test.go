@@ -2,6 +2,7 @@ package createServicePush_integration_test
 
 import (
 	"os/exec"
+	"strings"
 
 	plugin_models "code.cloudfoundry.org/cli/plugin/models"
 
@@ -49,14 +50,25 @@ var _ = Describe("CreateServicePush", func() {
 		//set rpc.CallCoreCommand to a successful call
 		//rpc.CallCoreCommand is used in both cliConnection.CliCommand() and
 		//cliConnection.CliWithoutTerminalOutput()
-		rpcHandlers.CallCoreCommandStub = func(_ []string, retVal *bool) error {
+		var lastCommand []string
+		rpcHandlers.CallCoreCommandStub = func(args []string, retVal *bool) error {
+			lastCommand = args
 			*retVal = true
 			return nil
 		}
 
 		//set rpc.GetOutputAndReset to return empty string; this is used by CliCommand()/CliWithoutTerminalOutput()
+		//The marketplace, which is read with cf curl before any service is created, offers the broker in the services manifests
 		rpcHandlers.GetOutputAndResetStub = func(_ bool, retVal *[]string) error {
 			*retVal = []string{"{}"}
+			if len(lastCommand) == 2 && lastCommand[0] == "curl" {
+				switch {
+				case strings.HasSuffix(lastCommand[1], "/services?results-per-page=100"):
+					*retVal = []string{`{"resources": [{"entity": {"label": "p-config-server", "service_plans_url": "/v2/services/config-server/service_plans"}}]}`}
+				case strings.HasPrefix(lastCommand[1], "/v2/services/config-server/service_plans"):
+					*retVal = []string{`{"resources": [{"entity": {"name": "standard"}}]}`}
+				}
+			}
 			return nil
 		}
 	})
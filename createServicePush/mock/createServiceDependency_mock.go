@@ -5,6 +5,7 @@ import (
 
 	"code.cloudfoundry.org/cli/plugin"
 	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/cspArguments"
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceCreator"
 	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
 )
 
@@ -14,9 +15,23 @@ type MockCreateService struct {
 	ParseHasError         bool
 	CreateServiceHasError bool
 	ServicesCreated       bool
+	BindServiceHasError   bool
+	ServicesBound         bool
 	DoNotCreateServices   bool
 	DoNotPush             bool
+	DryRun                bool
+	KeepGoing             bool
 	PlugIsUninstalling    bool
+	IsValidatingManifest  bool
+	CheckMarketplaceFlag  bool
+	MarketplaceHasError   bool
+	MarketplaceChecked    bool
+	SkipMarketplaceCheck  bool
+	Backend               string
+	ReportFormat          string
+	ReportFile            string
+	CreateServicesOptions serviceCreator.Options
+	CreateServicesResults *serviceCreator.Results
 }
 
 func NewMockCreateService() *MockCreateService {
@@ -31,7 +46,15 @@ func (mcsp *MockCreateService) Process(args []string) (*cspArguments.CSPArgument
 	return &cspArguments.CSPArguments{
 		DoNotCreateServices:  mcsp.DoNotCreateServices,
 		DoNotPush:            mcsp.DoNotPush,
+		DryRun:               mcsp.DryRun,
+		KeepGoing:            mcsp.KeepGoing,
 		IsUninstallingPlugin: mcsp.PlugIsUninstalling,
+		IsValidatingManifest: mcsp.IsValidatingManifest,
+		CheckMarketplace:     mcsp.CheckMarketplaceFlag,
+		SkipMarketplaceCheck: mcsp.SkipMarketplaceCheck,
+		Backend:              mcsp.Backend,
+		ReportFormat:         mcsp.ReportFormat,
+		ReportFile:           mcsp.ReportFile,
 	}, err
 }
 
@@ -43,9 +66,18 @@ func (mcsp *MockCreateService) GetArgumentsDescription() map[string]string {
 	return map[string]string{}
 }
 
-func (mcsp *MockCreateService) CreateServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection) error {
+func (mcsp *MockCreateService) GetValidateUsage() string {
+	return ""
+}
+
+func (mcsp *MockCreateService) GetValidateArgumentsDescription() map[string]string {
+	return map[string]string{}
+}
+
+func (mcsp *MockCreateService) CreateServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options serviceCreator.Options) error {
 
 	var err error
+	mcsp.CreateServicesOptions = options
 	if mcsp.CreateServiceHasError {
 		err = fmt.Errorf("CreateServiceHasError = true")
 	} else {
@@ -54,6 +86,35 @@ func (mcsp *MockCreateService) CreateServices(manifest *serviceManifest.ServiceM
 	return err
 }
 
+func (mcsp *MockCreateService) BindServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options serviceCreator.Options) error {
+
+	var err error
+	if mcsp.BindServiceHasError {
+		err = fmt.Errorf("BindServiceHasError = true")
+	} else {
+		mcsp.ServicesBound = true
+	}
+	return err
+}
+
+func (mcsp *MockCreateService) CheckMarketplace(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options serviceCreator.Options) error {
+
+	var err error
+	if mcsp.MarketplaceHasError {
+		err = fmt.Errorf("MarketplaceHasError = true")
+	} else {
+		mcsp.MarketplaceChecked = true
+	}
+	return err
+}
+
+func (mcsp *MockCreateService) Results() *serviceCreator.Results {
+	if mcsp.CreateServicesResults == nil {
+		return serviceCreator.NewResults()
+	}
+	return mcsp.CreateServicesResults
+}
+
 // Parse parses a manifest from a reader
 func (mcsp *MockCreateService) Parse([]string, map[string]string) (*serviceManifest.ServiceManifest, error) {
 
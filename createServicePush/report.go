@@ -0,0 +1,121 @@
+package createServicePush
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceCreator"
+)
+
+// The outcomes of cf push in a report
+const (
+	PushSucceeded = "succeeded"
+	PushFailed    = "failed"
+	PushSkipped   = "skipped"
+	PushDryRun    = "dry-run"
+)
+
+// Report is the machine readable account of a run, written when --report-format is given
+type Report struct {
+	Services []ServiceReport `json:"services"`
+	Push     PushReport      `json:"push"`
+	Error    string          `json:"error,omitempty"`
+	DryRun   bool            `json:"dry_run,omitempty"` // Nothing was changed. The actions of the services are those that would be taken.
+
+	format   string
+	filename string
+}
+
+// ServiceReport describes what was done to a single service
+type ServiceReport struct {
+	Name            string              `json:"name"`
+	Action          string              `json:"action"` // created, updated, deleted, unchanged, skipped or failed. On a dry run, would-create, would-update or would-delete.
+	DurationSeconds float64             `json:"duration_seconds"`
+	LastOperation   LastOperationReport `json:"last_operation"`
+	Message         string              `json:"message,omitempty"`
+}
+
+// LastOperationReport is the final last operation of a service, if it was polled
+type LastOperationReport struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+// PushReport describes the outcome of cf push
+type PushReport struct {
+	Status string   `json:"status"`
+	Args   []string `json:"args"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// NewReport creates an empty report. A blank format means no report is written.
+func NewReport(format, filename string) *Report {
+	return &Report{
+		Services: []ServiceReport{},
+		Push:     PushReport{Status: PushSkipped, Args: []string{}},
+		format:   format,
+		filename: filename,
+	}
+}
+
+// AddServiceResults adds the outcome of each service to the report
+func (r *Report) AddServiceResults(results *serviceCreator.Results) {
+	for _, result := range results.Entries {
+		r.Services = append(r.Services, ServiceReport{
+			Name:            result.ServiceName,
+			Action:          reportAction(result, r.DryRun),
+			DurationSeconds: result.Duration.Seconds(),
+			LastOperation: LastOperationReport{
+				State:       result.LastOperationState,
+				Description: result.LastOperationDescription,
+			},
+			Message: result.Message,
+		})
+	}
+}
+
+// Write writes the report, in the requested format, to the report file or stdout
+func (r *Report) Write() error {
+	if r.format == "" {
+		return nil
+	}
+
+	bytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if r.filename == "" {
+		fmt.Printf("%s\n", bytes)
+		return nil
+	}
+	return ioutil.WriteFile(r.filename, append(bytes, '\n'), 0644)
+}
+
+// reportAction describes the action taken on a service in the past tense, or failed if the service failed.
+// On a dry run, the actions that change a service are described as what would be done.
+func reportAction(result serviceCreator.Result, dryRun bool) string {
+	if result.Status == serviceCreator.ResultFailed {
+		return "failed"
+	}
+
+	if dryRun {
+		switch result.Action {
+		case serviceCreator.PlanCreate, serviceCreator.PlanUpdate, serviceCreator.PlanDelete:
+			return "would-" + string(result.Action)
+		}
+	}
+
+	switch result.Action {
+	case serviceCreator.PlanCreate:
+		return "created"
+	case serviceCreator.PlanUpdate:
+		return "updated"
+	case serviceCreator.PlanUnchanged:
+		return "unchanged"
+	case serviceCreator.PlanDelete:
+		return "deleted"
+	}
+	return "skipped"
+}
@@ -3,7 +3,10 @@ package cspArguments
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Interface describes the interface to process input commandline arguments
@@ -11,6 +14,8 @@ type Interface interface {
 	Process(args []string) (*CSPArguments, error)
 	GetUsage() string
 	GetArgumentsDescription() map[string]string
+	GetValidateUsage() string
+	GetValidateArgumentsDescription() map[string]string
 }
 
 // CSPFlagProperty defines a flag in create-service-push, its properties and a handler to decode output to a CSPArgument struct
@@ -22,13 +27,45 @@ type CSPFlagProperty struct {
 	shouldDefer   bool // Specifies if this flag processing should be defered to the end of our Process method
 }
 
+// validateManifestFlags are the flags accepted by validate-service-manifest
+var validateManifestFlags = map[string]bool{
+	"--service-manifest":           true,
+	"--var":                        true,
+	"--vars-file":                  true,
+	"--use-env-vars-prefixed-with": true,
+	"--check-marketplace":          true,
+	"--backend":                    true,
+}
+
+// validateManifestOnlyFlags are the flags that are only accepted by validate-service-manifest
+var validateManifestOnlyFlags = map[string]bool{
+	"--check-marketplace": true,
+}
+
 // CSPArguments holds the Processed input arguments
 type CSPArguments struct {
 	IsUninstallingPlugin     bool
+	IsValidatingManifest     bool // validate-service-manifest is being run, rather than create-service-push
+	CheckMarketplace         bool
 	ServiceManifestFilename  string
 	DoNotCreateServices      bool
 	DoNotPush                bool
 	PushAsSubProcess         bool
+	DryRun                   bool
+	Parallel                 int
+	ServiceTimeout           time.Duration
+	PollInterval             time.Duration
+	AllowPlanChanges         bool
+	Prune                    bool
+	PruneOwner               string // Identifies the services manifest whose services may be pruned. Required with --prune.
+	ConfirmPrune             bool
+	KeepGoing                bool
+	Retries                  int
+	WarnOnConflicts          bool
+	SkipMarketplaceCheck     bool
+	Backend                  string // How services are created, cli, v3 or fake. "" == cli
+	ReportFormat             string // Format of the run report. "" == no report
+	ReportFile               string // File the run report is written to. "" == stdout
 	StaticVariablesFilePaths []string
 	StaticVariables          map[string]string
 	OtherCFArgs              []string                    // Holds other commandline arguments that isn't used by CSP. This will be passed to cf push.
@@ -42,6 +79,8 @@ func NewCSPArguments() *CSPArguments {
 		DoNotCreateServices:      false,
 		DoNotPush:                false,
 		PushAsSubProcess:         false,
+		DryRun:                   false,
+		Parallel:                 1,
 		StaticVariablesFilePaths: []string{},
 		StaticVariables:          map[string]string{},
 		OtherCFArgs:              []string{},
@@ -181,6 +220,297 @@ func NewCSPArguments() *CSPArguments {
 				shouldDefer: false,
 			},
 			/////////////////////////////////////////////////
+			"--dry-run": &CSPFlagProperty{
+				description:   "Show the services that would be created, updated or skipped, along with the cf commands, without making any changes or pushing the application",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if csp.cspFlags["--no-service-manifest"].processed {
+						*err = fmt.Errorf("--dry-run cannot be used in conjunction with --no-service-manifest")
+						return
+					}
+					*err = nil
+					csp.DryRun = true
+					csp.cspFlags["--dry-run"].processed = true
+				},
+				processed:   false,
+				shouldDefer: true, // We need to defer because we want to ensure --no-service-manifest is processed first
+			},
+			/////////////////////////////////////////////////
+			"--parallel": &CSPFlagProperty{
+				description:   "Takes one input specifying the maximum number of services to provision at the same time, e.g., --parallel 4. Defaults to 1.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure parallel has a count parameter
+						count, convErr := strconv.Atoi(args[index+1])
+						if convErr != nil || count < 1 {
+							*err = fmt.Errorf("--parallel requires a positive whole number. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.Parallel = count
+						csp.cspFlags["--parallel"].processed = true
+					} else {
+						*err = fmt.Errorf("--parallel is missing a count argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--service-timeout": &CSPFlagProperty{
+				description:   "Takes one input specifying how long to wait for each brokered service to finish, e.g., --service-timeout 30m. Defaults to waiting forever. A timeout in the service manifest takes precedence.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure service-timeout has a duration parameter
+						duration, parseErr := time.ParseDuration(args[index+1])
+						if parseErr != nil || duration < 0 {
+							*err = fmt.Errorf("--service-timeout requires a duration such as 90s, 10m or 1h. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.ServiceTimeout = duration
+						csp.cspFlags["--service-timeout"].processed = true
+					} else {
+						*err = fmt.Errorf("--service-timeout is missing a duration argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--poll-interval": &CSPFlagProperty{
+				description:   "Takes one input specifying the initial time between checks on a brokered service's progress, e.g., --poll-interval 5s. The time doubles after each check, up to 30s. Defaults to 2s. A pollInterval in the service manifest takes precedence.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure poll-interval has a duration parameter
+						duration, parseErr := time.ParseDuration(args[index+1])
+						if parseErr != nil || duration <= 0 {
+							*err = fmt.Errorf("--poll-interval requires a duration such as 5s or 1m. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.PollInterval = duration
+						csp.cspFlags["--poll-interval"].processed = true
+					} else {
+						*err = fmt.Errorf("--poll-interval is missing a duration argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--allow-plan-changes": &CSPFlagProperty{
+				description:   "Change the plan of existing brokered services when it differs from the plan in the services manifest",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					*err = nil
+					csp.AllowPlanChanges = true
+					csp.cspFlags["--allow-plan-changes"].processed = true
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--prune": &CSPFlagProperty{
+				description:   "Delete services, previously created by this plugin with --prune and the same --prune-owner, that are no longer in the services manifest. Requires --prune-owner, and --confirm-prune to actually delete them",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if csp.cspFlags["--no-service-manifest"].processed {
+						*err = fmt.Errorf("--prune cannot be used in conjunction with --no-service-manifest")
+						return
+					}
+					if !csp.cspFlags["--prune-owner"].processed {
+						*err = fmt.Errorf("--prune requires --prune-owner, naming the services manifest whose services may be pruned")
+						return
+					}
+					*err = nil
+					csp.Prune = true
+					csp.cspFlags["--prune"].processed = true
+				},
+				processed:   false,
+				shouldDefer: true, // We need to defer because we want to ensure --no-service-manifest is processed first
+			},
+			/////////////////////////////////////////////////
+			"--prune-owner": &CSPFlagProperty{
+				description:   "Takes one input naming the owner of the services in the services manifest, e.g., --prune-owner orders-app. Services created or updated with --prune are tagged with their owner, and only services of the same owner are pruned, so each services manifest in a space should have its own owner.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure prune-owner has an owner parameter
+						if strings.HasPrefix(args[index+1], "-") || strings.Contains(args[index+1], ",") {
+							*err = fmt.Errorf("--prune-owner requires an owner without commas. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.PruneOwner = args[index+1]
+						csp.cspFlags["--prune-owner"].processed = true
+					} else {
+						*err = fmt.Errorf("--prune-owner is missing an owner argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--confirm-prune": &CSPFlagProperty{
+				description:   "Confirms that services marked absent in the services manifest, or found by --prune, should be deleted",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					*err = nil
+					csp.ConfirmPrune = true
+					csp.cspFlags["--confirm-prune"].processed = true
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--keep-going": &CSPFlagProperty{
+				description:   "Attempt to create every service, rather than stopping at the first failure. The failures are reported together once all services have been attempted.",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					*err = nil
+					csp.KeepGoing = true
+					csp.cspFlags["--keep-going"].processed = true
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--warn-on-conflicts": &CSPFlagProperty{
+				description:   "Warn about and skip, rather than fail on, services whose type or broker differs from the existing instance of the same name",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					*err = nil
+					csp.WarnOnConflicts = true
+					csp.cspFlags["--warn-on-conflicts"].processed = true
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--retries": &CSPFlagProperty{
+				description:   "Takes one input specifying how many times to retry a cf call that fails with a transient error, such as a 502 from the Cloud Controller with --backend v3, or another operation in progress on the service, e.g., --retries 3. Failed cf CLI commands are only retried for another operation in progress. The time between retries starts at 2s and doubles after each retry. Defaults to 0. The retries of a service in the service manifest take precedence.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure retries has a count parameter
+						count, convErr := strconv.Atoi(args[index+1])
+						if convErr != nil || count < 0 {
+							*err = fmt.Errorf("--retries requires a whole number of 0 or more. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.Retries = count
+						csp.cspFlags["--retries"].processed = true
+					} else {
+						*err = fmt.Errorf("--retries is missing a count argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--report-format": &CSPFlagProperty{
+				description:   "Takes one input specifying the format of a report of what was done to each service and the push, written once the command completes, e.g., --report-format json. Only json is supported. The report is written to stdout, unless --report-file is given.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure report-format has a format parameter
+						if args[index+1] != "json" {
+							*err = fmt.Errorf("--report-format only supports json. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.ReportFormat = args[index+1]
+						csp.cspFlags["--report-format"].processed = true
+					} else {
+						*err = fmt.Errorf("--report-format is missing a format argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--report-file": &CSPFlagProperty{
+				description:   "Takes one input specifying the fullpath and filename the report is written to, e.g., --report-file report.json. Implies --report-format json.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure report-file has a filename parameter
+						if strings.HasPrefix(args[index+1], "-") {
+							*err = fmt.Errorf("--report-file requires a filename argument. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.ReportFile = args[index+1]
+						if csp.ReportFormat == "" {
+							csp.ReportFormat = "json"
+						}
+						csp.cspFlags["--report-file"].processed = true
+					} else {
+						*err = fmt.Errorf("--report-file is missing a filename argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--backend": &CSPFlagProperty{
+				description:   "Takes one input specifying how services are created, e.g., --backend v3. cli runs cf CLI commands and is the default. v3 calls the service instance endpoints of the Cloud Controller v3 API directly, for cf7/cf8 and foundations with the v2 API disabled. fake creates services on an in-memory foundation, to try out a services manifest without a real CF.",
+				argumentCount: 1,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					if (index + 1) < len(args) { // Ensure backend has a backend parameter
+						if args[index+1] != "cli" && args[index+1] != "v3" && args[index+1] != "fake" {
+							*err = fmt.Errorf("--backend only supports cli, v3 or fake. \"%s\" was found instead", args[index+1])
+							return
+						}
+
+						csp.Backend = args[index+1]
+						csp.cspFlags["--backend"].processed = true
+					} else {
+						*err = fmt.Errorf("--backend is missing a backend argument")
+						return
+					}
+					*err = nil
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--skip-marketplace-check": &CSPFlagProperty{
+				description:   "Do not check that the broker and plan of every brokered service are in the marketplace before creating any service",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					*err = nil
+					csp.SkipMarketplaceCheck = true
+					csp.cspFlags["--skip-marketplace-check"].processed = true
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
+			"--check-marketplace": &CSPFlagProperty{
+				description:   "Only used by validate-service-manifest. Checks that the broker and plan of every brokered service are offered in the marketplace of the targeted space",
+				argumentCount: 0,
+				handler: func(index int, args []string, csp *CSPArguments, err *error) {
+					*err = nil
+					csp.CheckMarketplace = true
+					csp.cspFlags["--check-marketplace"].processed = true
+				},
+				processed:   false,
+				shouldDefer: false,
+			},
+			/////////////////////////////////////////////////
 			"--no-service-manifest": &CSPFlagProperty{
 				description:   "Specifies that there is no service creation manifest",
 				argumentCount: 0,
@@ -237,6 +567,13 @@ func (csp *CSPArguments) GetUsage() string {
                            [ --no-push | --push-as-subprocess ]
                            [ --var KEY=VALUE ] [ --vars-file VARS_FILE_FULL_PATH ]
                            [ --use-env-vars-prefixed-with PREFIX ]
+                           [ --dry-run ] [ --parallel COUNT ]
+                           [ --service-timeout DURATION ] [ --poll-interval DURATION ]
+                           [ --allow-plan-changes ] [ --prune --prune-owner OWNER ] [ --confirm-prune ]
+                           [ --keep-going ]
+                           [ --retries COUNT ] [ --warn-on-conflicts ] [ --skip-marketplace-check ]
+                           [ --backend cli|v3|fake ]
+                           [ --report-format json ] [ --report-file REPORT_FULL_PATH ]
                            [CF_PUSH_ARGUMENTS]
     NOTES:
     a) APP_NAME is optional but should always be at the first position. cf push will validate this.
@@ -251,6 +588,57 @@ func (csp *CSPArguments) GetUsage() string {
     c) By default --var and --vars-file will not be passed to cf push due to non-support in the cf plugin architecture. However,
        support for variable substitution is built into the plugin.  To pass --var and --vars-file parameters to cf push, use 
        it with the --push-as-subprocess flag. Please ensure that the cf cli installed on the machine is at least release 6.37.0.
+
+    d) --dry-run reads the services manifest and queries the targeted space, then prints whether each service would be
+       created, updated or skipped along with the cf command that would be run. Nothing is created and cf push is not run.
+
+    e) --parallel COUNT starts up to COUNT brokered services at a time and waits on all of them together, rather than waiting
+       for each service to finish before starting the next. A table of results is shown once all services have completed.
+
+    f) --service-timeout and --poll-interval take durations such as 90s, 10m or 1h. The time between checks on a brokered
+       service starts at the poll interval and doubles after each check. The timeout and pollInterval fields of a service in
+       the services manifest take precedence over these flags.
+
+    g) Services with state: absent in the services manifest are deleted, after being unbound from their apps, having their
+       service keys deleted and being unshared from other spaces. --prune also deletes services tagged by a previous run
+       with --prune and the same --prune-owner that are no longer in the services manifest, so give each services manifest
+       in a space its own owner. No service is deleted unless --confirm-prune is also given; otherwise the services that
+       would be deleted are listed.
+
+    h) --report-format json writes a JSON report once the command completes, or fails, with the action taken on each service,
+       how long it took, its final last operation and the outcome of cf push. --report-file writes the report to a file
+       rather than stdout, which keeps it apart from the rest of the output. With --dry-run, the report is marked as a dry
+       run and lists the services that would be created, updated or deleted as would-create, would-update or would-delete.
+
+    i) --keep-going attempts every service, rather than stopping at the first failure. Services that depend on a failed service
+       are not attempted. A table of results is shown once all services have been attempted, and the command fails with an
+       error listing each service that failed. cf push is not run if any service failed.
+
+    j) --retries COUNT retries cf calls that fail with a transient error, e.g., a 502 from the Cloud Controller or an expired
+       token, up to COUNT times. Each retry is logged, and the time between retries starts at 2s and doubles after each
+       retry. Permanent errors, such as a plan that doesn't exist, are not retried. The cf CLI doesn't pass the reason a
+       command failed on to plugins, so a failed cf CLI command, e.g., cf create-service, is only retried when its service
+       has another operation in progress. Every request of --backend v3 is retried on a 502, 503 or 504, another operation
+       in progress, an invalid token or a network failure. The retries field of a service in the services manifest takes
+       precedence over this flag.
+
+    k) An existing service whose type, i.e., user provided or brokered, or broker differs from its entry in the services
+       manifest is a conflict, and fails the command with the differences between the two. --warn-on-conflicts prints the
+       differences as a warning and skips the service instead. A different plan alone is not a conflict.
+
+    l) Before any service is created, the broker and plan of every brokered service that doesn't already exist on them are
+       looked up in the marketplace of the targeted space. If any are missing, the command fails with a list of them and
+       the closest matches, without creating anything. --skip-marketplace-check skips this check.
+
+    m) --backend v3 creates, updates and deletes services, and waits on their jobs and last operations, with the Cloud
+       Controller v3 API, using the API endpoint and access token of the cf CLI. Use it with cf7 or cf8, or with foundations
+       that have the v2 API disabled. Service keys, shares and bindings are still made with cf CLI commands. The labels and
+       annotations of a service in the services manifest are set with any backend.
+
+    n) --backend fake creates services on an in-memory foundation instead of the targeted CF, which needs no login. Brokered
+       services take a couple of polls to complete, and a service with a "fake-failure" parameter fails with that message.
+       The fake foundation is saved to fake-foundation.json in the current directory, so that a rerun updates the services
+       it created. cf push is not run, but bindings to the apps in the services manifest are made on the fake foundation.
        `
 }
 
@@ -258,7 +646,42 @@ func (csp *CSPArguments) GetUsage() string {
 func (csp *CSPArguments) GetArgumentsDescription() map[string]string {
 	arguments := make(map[string]string)
 	for flag, property := range csp.cspFlags {
-		arguments[flag] = property.description
+		if !validateManifestOnlyFlags[flag] {
+			arguments[flag] = property.description
+		}
+	}
+	return arguments
+}
+
+// GetValidateUsage returns the usage instruction text to display when help is called for validate-service-manifest.
+func (csp *CSPArguments) GetValidateUsage() string {
+	return `
+    cf validate-service-manifest
+                           [ --service-manifest SERVICE_MANIFEST_FULL_PATH ]
+                           [ --var KEY=VALUE ] [ --vars-file VARS_FILE_FULL_PATH ]
+                           [ --use-env-vars-prefixed-with PREFIX ]
+                           [ --check-marketplace ] [ --backend cli|v3|fake ]
+    NOTES:
+    a) The services manifest is read, its variables are substituted and it is checked for problems, such as unknown keys,
+       missing fields and duplicate service names, exactly as create-service-push would. Nothing is created or pushed.
+
+    b) --check-marketplace also checks that the broker and plan of every brokered service are offered in the marketplace
+       of the targeted space. This requires being logged in and targeting a space.
+
+    c) --backend v3 looks up the marketplace with the Cloud Controller v3 API, rather than the v2 API. --backend fake
+       checks against the marketplace of the fake foundation, which has p-mysql, p-redis, p-rabbitmq, p-config-server and
+       p-service-registry.
+       `
+}
+
+// GetValidateArgumentsDescription returns the usage instruction text, for the flags of validate-service-manifest,
+// to display when help is called.
+func (csp *CSPArguments) GetValidateArgumentsDescription() map[string]string {
+	arguments := make(map[string]string)
+	for flag, property := range csp.cspFlags {
+		if validateManifestFlags[flag] {
+			arguments[flag] = strings.TrimPrefix(property.description, "Only used by validate-service-manifest. ")
+		}
 	}
 	return arguments
 }
@@ -271,10 +694,14 @@ func (csp *CSPArguments) Process(args []string) (*CSPArguments, error) {
 		return csp, nil
 	}
 
-	if args[0] != "create-service-push" {
-		return csp, fmt.Errorf("This plugin only works with create-service-push")
+	switch args[0] {
+	case "create-service-push":
+	case "validate-service-manifest":
+		csp.IsValidatingManifest = true
+	default:
+		return csp, fmt.Errorf("This plugin only works with create-service-push or validate-service-manifest")
 	}
-	args = args[1:] // Remove the create-service-push tag
+	args = args[1:] // Remove the command name
 
 	// If there were no other arguments, we can short circuit the Process method
 	if len(args) == 0 {
@@ -312,5 +739,31 @@ func (csp *CSPArguments) Process(args []string) (*CSPArguments, error) {
 		}
 	}
 
-	return csp, nil
+	return csp, csp.checkCommandFlags()
+}
+
+// checkCommandFlags returns an error if a flag, or an argument for cf push, was given to a command that doesn't accept it
+func (csp *CSPArguments) checkCommandFlags() error {
+	flags := []string{}
+	for flag := range csp.cspFlags {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+
+	for _, flag := range flags {
+		if !csp.cspFlags[flag].processed {
+			continue
+		}
+		if csp.IsValidatingManifest && !validateManifestFlags[flag] {
+			return fmt.Errorf("%s is not supported by validate-service-manifest", flag)
+		}
+		if !csp.IsValidatingManifest && validateManifestOnlyFlags[flag] {
+			return fmt.Errorf("%s is only supported by validate-service-manifest", flag)
+		}
+	}
+
+	if csp.IsValidatingManifest && len(csp.OtherCFArgs) > 0 {
+		return fmt.Errorf("validate-service-manifest does not push an application, so it does not accept %s", strings.Join(csp.OtherCFArgs, " "))
+	}
+	return nil
 }
@@ -3,6 +3,7 @@ package cspArguments_test
 import (
 	"os"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -214,4 +215,179 @@ var _ = Describe("CspArguments", func() {
 		Expect(csp.StaticVariables).Should(HaveKeyWithValue("CSPENV_VariableA", "12345"))
 		Expect(csp.StaticVariables).Should(HaveKeyWithValue("CSPENV_VariableB", "David"))
 	})
+
+	It("Should handle --dry-run", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--dry-run"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.DryRun).To(BeTrue())
+		Expect(csp.OtherCFArgs).ShouldNot(ContainElement("--dry-run"))
+	})
+
+	It("Should give error when --dry-run is combined with --no-service-manifest", func() {
+		_, err := cspArgs.Process([]string{"create-service-push", "myapp", "--dry-run", "--no-service-manifest"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should handle --parallel", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--parallel", "4"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.Parallel).To(Equal(4))
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should handle bad inputs of --parallel", func() {
+		_, err := cspArgs.Process([]string{"create-service-push", "--parallel", "zero"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = cspArgs.Process([]string{"create-service-push", "--parallel", "0"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = cspArgs.Process([]string{"create-service-push", "--parallel"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should handle --service-timeout and --poll-interval", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--service-timeout", "30m", "--poll-interval", "5s"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.ServiceTimeout).To(Equal(30 * time.Minute))
+		Expect(csp.PollInterval).To(Equal(5 * time.Second))
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should handle bad inputs of --service-timeout and --poll-interval", func() {
+		_, err := cspArgs.Process([]string{"create-service-push", "--service-timeout", "forever"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = cspArgs.Process([]string{"create-service-push", "--poll-interval", "0s"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = cspArgs.Process([]string{"create-service-push", "--poll-interval"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should handle --allow-plan-changes", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--allow-plan-changes"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.AllowPlanChanges).To(BeTrue())
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should handle --prune, --prune-owner and --confirm-prune", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--prune", "--prune-owner", "orders", "--confirm-prune"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.Prune).To(BeTrue())
+		Expect(csp.PruneOwner).To(Equal("orders"))
+		Expect(csp.ConfirmPrune).To(BeTrue())
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should give error when --prune is used without --prune-owner", func() {
+		_, err := cspArgs.Process([]string{"create-service-push", "myapp", "--prune"})
+		Expect(err).Should(MatchError(ContainSubstring("--prune requires --prune-owner")))
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "--prune", "--prune-owner", "orders,billing"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should give error when --prune is combined with --no-service-manifest", func() {
+		_, err := cspArgs.Process([]string{"create-service-push", "--prune", "--prune-owner", "orders", "--no-service-manifest"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should handle --report-format and --report-file", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--report-format", "json"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.ReportFormat).Should(Equal("json"))
+		Expect(csp.ReportFile).Should(Equal(""))
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+
+		csp, err = NewCSPArguments().Process([]string{"create-service-push", "myapp", "--report-file", "report.json"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.ReportFormat).Should(Equal("json"))
+		Expect(csp.ReportFile).Should(Equal("report.json"))
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should give error when --report-format is not json or --report-file is missing its filename", func() {
+		_, err := cspArgs.Process([]string{"create-service-push", "--report-format", "yaml"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "--report-file", "--no-push"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "--report-file"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should handle --keep-going", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--keep-going"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.KeepGoing).To(BeTrue())
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should handle --retries", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--retries", "3"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.Retries).Should(Equal(3))
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "--retries", "-1"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "--retries"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should handle --warn-on-conflicts", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--warn-on-conflicts"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.WarnOnConflicts).To(BeTrue())
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should handle validate-service-manifest with the flags it supports", func() {
+		csp, err := cspArgs.Process([]string{"validate-service-manifest", "--service-manifest", "my-manifest.yml", "--var", "env=dev", "--check-marketplace"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.IsValidatingManifest).To(BeTrue())
+		Expect(csp.CheckMarketplace).To(BeTrue())
+		Expect(csp.ServiceManifestFilename).Should(Equal("my-manifest.yml"))
+		Expect(csp.StaticVariables).Should(HaveKeyWithValue("env", "dev"))
+	})
+
+	It("Should only accept the validate-service-manifest flags with validate-service-manifest", func() {
+		_, err := NewCSPArguments().Process([]string{"validate-service-manifest", "--dry-run"})
+		Expect(err).Should(MatchError("--dry-run is not supported by validate-service-manifest"))
+
+		_, err = NewCSPArguments().Process([]string{"validate-service-manifest", "myapp"})
+		Expect(err).Should(MatchError("validate-service-manifest does not push an application, so it does not accept myapp"))
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "myapp", "--check-marketplace"})
+		Expect(err).Should(MatchError("--check-marketplace is only supported by validate-service-manifest"))
+	})
+
+	It("Should handle --skip-marketplace-check", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--skip-marketplace-check"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.SkipMarketplaceCheck).To(BeTrue())
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+	})
+
+	It("Should handle --backend", func() {
+		csp, err := cspArgs.Process([]string{"create-service-push", "myapp", "--backend", "v3"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.Backend).Should(Equal("v3"))
+		Expect(csp.OtherCFArgs).Should(Equal([]string{"myapp"}))
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "--backend", "v2"})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("--backend only supports cli, v3 or fake"))
+
+		csp, err = NewCSPArguments().Process([]string{"create-service-push", "--backend", "fake"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(csp.Backend).Should(Equal("fake"))
+
+		_, err = NewCSPArguments().Process([]string{"create-service-push", "--backend"})
+		Expect(err).Should(HaveOccurred())
+	})
 })
@@ -14,4 +14,5 @@ require (
 	github.com/onsi/gomega v1.7.0
 	github.com/stretchr/testify v1.4.0 // indirect
 	gopkg.in/yaml.v2 v2.2.4
+	gopkg.in/yaml.v3 v3.0.1
 )
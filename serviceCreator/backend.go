@@ -0,0 +1,144 @@
+package serviceCreator
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// The backends that services can be created with
+const (
+	BackendCLI  = "cli"  // Runs cf CLI commands, e.g., cf create-service, and reads services through the plugin models
+	BackendV3   = "v3"   // Calls the service instance endpoints of the Cloud Controller v3 API directly
+	BackendFake = "fake" // An in-memory foundation, for trying out a services manifest without a real CF
+)
+
+// ServiceBackend carries out the operations on the service instances in the targeted space, along with their keys,
+// shares and bindings. Operations on brokered services may be asynchronous, in which case they are waited on through
+// the last operation returned by GetService.
+type ServiceBackend interface {
+	ListServices() ([]plugin_models.GetServices_Model, error)
+	GetService(name string) (plugin_models.GetService_Model, error)
+	CreateService(request ServiceRequest) error
+	UpdateService(request ServiceRequest) error
+	DeleteService(name string) error
+
+	GetServiceTags(service plugin_models.GetServices_Model) ([]string, error)
+	GetServiceLabels(guid string) (map[string]string, error)
+	GetServiceCredentials(guid string) (map[string]interface{}, error) // The credentials of a user provided service
+	SetServiceMetadata(guid string, labels, annotations map[string]string) error
+
+	ListServiceKeys(guid string) (map[string]bool, error) // The set of key names of a service instance
+	CreateServiceKey(name, key, parameters string) error
+	DeleteServiceKey(name, key string) error
+
+	ListShares(guid string) (map[string]bool, error) // The set of org/space targets a service instance is shared to
+	ShareService(name, org, space string) error
+	UnshareService(name, org, space string) error
+
+	BindService(app, name, parameters string) error
+	UnbindService(app, name string) error
+	RestageApp(app string) error
+
+	// GetMarketplace returns the plans of each service offering, by name, that is visible in the targeted space.
+	// The plans need only be looked up for the named offerings.
+	GetMarketplace(offerings []string) (map[string]map[string]bool, error)
+}
+
+// ServiceRequest describes a service instance to create or update
+type ServiceRequest struct {
+	Name        string
+	Type        string // brokered, credentials, drain or route. Blank is brokered.
+	Broker      string // The service offering of a brokered service
+	Plan        string // The plan of a brokered service. Blank, on update, keeps the current plan.
+	Parameters  string // The JSON parameters of a brokered service. Blank passes none.
+	Credentials string // The JSON credentials of a credentials service
+	URL         string // The url of a drain or route service
+	Tags        string // Comma separated tags. Blank passes none, which leaves the tags of an existing service as they are.
+}
+
+// isUserProvided returns true if the request is for a user provided service
+func (r ServiceRequest) isUserProvided() bool {
+	return r.Type == "credentials" || r.Type == "drain" || r.Type == "route"
+}
+
+// cfCommand returns the cf command that creates, or updates, the service. It describes the request in the plan,
+// whichever backend carries it out.
+func (r ServiceRequest) cfCommand(update bool) []string {
+	var args []string
+	if r.isUserProvided() {
+		command := "cups"
+		if update {
+			command = "uups"
+		}
+
+		switch r.Type {
+		case "credentials":
+			args = []string{command, r.Name, "-p", r.Credentials}
+		case "route":
+			args = []string{command, r.Name, "-r", r.URL}
+		case "drain":
+			args = []string{command, r.Name, "-l", r.URL}
+		}
+		if r.Tags != "" {
+			args = append(args, "-t", r.Tags)
+		}
+		return args
+	}
+
+	if update {
+		args = []string{"update-service", r.Name}
+		if r.Plan != "" {
+			args = append(args, "-p", r.Plan)
+		}
+	} else {
+		args = []string{"create-service", r.Broker, r.Plan, r.Name}
+	}
+
+	if r.Tags != "" {
+		args = append(args, "-t", r.Tags)
+	}
+	if r.Parameters != "" {
+		args = append(args, "-c", r.Parameters)
+	}
+	return args
+}
+
+// withParameters appends the -c argument of a cf command, if there are parameters
+func withParameters(args []string, parameters string) []string {
+	if parameters == "" {
+		return args
+	}
+	return append(args, "-c", parameters)
+}
+
+// The cf commands for the operations on services, other than creating and updating them
+func deleteServiceCommand(name string) []string {
+	return []string{"delete-service", name, "-f"}
+}
+
+func createServiceKeyCommand(name, key, parameters string) []string {
+	return withParameters([]string{"create-service-key", name, key}, parameters)
+}
+
+func deleteServiceKeyCommand(name, key string) []string {
+	return []string{"delete-service-key", name, key, "-f"}
+}
+
+func shareServiceCommand(name, org, space string) []string {
+	return []string{"share-service", name, "-s", space, "-o", org}
+}
+
+func unshareServiceCommand(name, org, space string) []string {
+	return []string{"unshare-service", name, "-s", space, "-o", org, "-f"}
+}
+
+func bindServiceCommand(app, name, parameters string) []string {
+	return withParameters([]string{"bind-service", app, name}, parameters)
+}
+
+func unbindServiceCommand(app, name string) []string {
+	return []string{"unbind-service", app, name}
+}
+
+func restageCommand(app string) []string {
+	return []string{"restage", app}
+}
@@ -0,0 +1,105 @@
+package serviceCreator
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// BindServices binds the services specified by manifest to the apps listed in their bind-to field
+// and then restages the apps that have new bindings.
+func (c *ServiceCreator) BindServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options Options) error {
+
+	bindServicesobject := &ServiceCreator{
+		manifest:         manifest,
+		cf:               cf,
+		progressReporter: NewProgressReporter(),
+		options:          options,
+		plan:             NewPlan(),
+		backend:          c.backend,
+	}
+	bindServicesobject.inventory = NewInventory(bindServicesobject.getServices)
+	if err := bindServicesobject.connectBackend(); err != nil {
+		return err
+	}
+
+	return bindServicesobject.bindServices()
+}
+
+func (c *ServiceCreator) bindServices() error {
+	hasBindings := false
+	for _, serviceObject := range c.manifest.Services {
+		if len(serviceObject.BindTo) > 0 {
+			hasBindings = true
+		}
+	}
+	if !hasBindings {
+		return nil
+	}
+
+	existingServices, err := c.inventory.All()
+	if err != nil {
+		return err
+	}
+
+	boundApps := map[string]map[string]bool{}
+	for _, existing := range existingServices {
+		boundApps[existing.Name] = map[string]bool{}
+		for _, appName := range existing.ApplicationNames {
+			boundApps[existing.Name][appName] = true
+		}
+	}
+
+	// Bind each service to the apps it isn't already bound to, and keep track of
+	// the apps, in order, that need to be restaged to pick up their new bindings.
+	appsToRestage := []string{}
+	restaging := map[string]bool{}
+	for _, serviceObject := range c.manifest.Services {
+		if serviceObject.State == "absent" {
+			continue
+		}
+
+		name := serviceObject.ServiceName
+		for _, appName := range serviceObject.BindTo {
+			if boundApps[name][appName] {
+				fmt.Printf("%s - already bound to %s...skipping binding\n", name, appName)
+				continue
+			}
+
+			fmt.Printf("%s - will now be bound to %s.\n", name, appName)
+			appName, parameters := appName, serviceObject.BindingParameters
+			err = c.execute(name, PlanCreate, bindServiceCommand(appName, name, parameters), func() error {
+				return c.backend.BindService(appName, name, parameters)
+			})
+			if err != nil {
+				return err
+			}
+
+			if !restaging[appName] {
+				restaging[appName] = true
+				appsToRestage = append(appsToRestage, appName)
+			}
+		}
+	}
+
+	if c.options.NoStart && len(appsToRestage) > 0 {
+		fmt.Printf("--no-start applied: The bound apps will pick up their new bindings when they are started\n")
+	} else {
+		for _, appName := range appsToRestage {
+			fmt.Printf("%s - will now be restaged to pick up its new bindings.\n", appName)
+			appName := appName
+			err = c.execute(appName, PlanUpdate, restageCommand(appName), func() error { return c.backend.RestageApp(appName) })
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.options.DryRun && len(c.plan.Entries) > 0 {
+		fmt.Printf("\nDry run - no changes were made. The following bindings would be performed:\n")
+		c.plan.Print(fmt.Printf)
+	}
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package serviceCreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// cliBackend carries out the operations on services with cf CLI commands, e.g., cf create-service, and reads them
+// through the plugin models. What the plugin models don't include, i.e., tags, keys, shares and the marketplace, and
+// the metadata and credentials that are only in the v3 API, is read from, or written to, the Cloud Controller with
+// cf curl.
+type cliBackend struct {
+	cf plugin.CliConnection
+}
+
+func newCLIBackend(cf plugin.CliConnection) *cliBackend {
+	return &cliBackend{cf: cf}
+}
+
+// cliCommandFailed is the error of every cf CLI command that fails. The cf CLI only prints the reason to the
+// terminal, and passes neither it nor the output of the command on to plugins.
+const cliCommandFailed = "Error executing cli core command"
+
+func (b *cliBackend) run(args ...string) error {
+	fmt.Printf("Now Running CLI Command: %s\n", strings.Join(args, " "))
+	_, err := b.cf.CliCommand(args...)
+	return err
+}
+
+// runOnService runs a cf CLI command that acts on the named service. Since the reason a command failed can't be
+// read, the service is looked up to find out whether another operation on it was in progress, which is the one
+// failure of a cf CLI command that is known to be retryable.
+func (b *cliBackend) runOnService(name string, args ...string) error {
+	err := b.run(args...)
+	if err == nil || err.Error() != cliCommandFailed {
+		return err
+	}
+
+	if service, getErr := b.cf.GetService(name); getErr == nil && service.LastOperation.State == "in progress" {
+		return &operationInProgressError{err: err, name: name}
+	}
+	return err
+}
+
+// operationInProgressError is the error of a cf CLI command that failed while another operation was in progress on
+// its service, which is retryable
+type operationInProgressError struct {
+	err  error
+	name string
+}
+
+func (e *operationInProgressError) Error() string {
+	return fmt.Sprintf("%s: another operation for service instance %s is in progress", e.err, e.name)
+}
+
+// curl gets a Cloud Controller endpoint and decodes its JSON response
+func (b *cliBackend) curl(path string, response interface{}) error {
+	output, err := b.cf.CliCommandWithoutTerminalOutput("curl", path)
+	if err != nil {
+		return err
+	}
+
+	body := []byte(strings.Join(output, "\n"))
+	if err = curlFailure(path, body); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("unable to read the response of %s: %s", path, err)
+	}
+	return nil
+}
+
+// curlError is a Cloud Controller error returned to cf curl. cf curl doesn't fail on an error response, but passes
+// its body on as the output instead.
+type curlError struct {
+	path        string
+	title       string // The error code of a v2 error, or the title of a v3 error, e.g., CF-NotAuthorized
+	description string
+}
+
+func (e *curlError) Error() string {
+	return fmt.Sprintf("cf curl %s failed with %s: %s", e.path, e.title, e.description)
+}
+
+// curlFailure returns the error in the response body of a cf curl request, if it is a v2 or v3 Cloud Controller error
+func curlFailure(path string, body []byte) error {
+	var response struct {
+		ErrorCode   string `json:"error_code"`
+		Description string `json:"description"`
+		Errors      []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil
+	}
+
+	if response.ErrorCode != "" {
+		return &curlError{path: path, title: response.ErrorCode, description: response.Description}
+	}
+	if len(response.Errors) > 0 && response.Errors[0].Title != "" {
+		return &curlError{path: path, title: response.Errors[0].Title, description: response.Errors[0].Detail}
+	}
+	return nil
+}
+
+// curlPages gets every page of a v2 collection with cf curl, passing each page to read. A page holds at most 100
+// resources, so the next_url of each page is followed until there are no more.
+func (b *cliBackend) curlPages(path string, read func(page []byte) error) error {
+	for path != "" {
+		var page json.RawMessage
+		if err := b.curl(path, &page); err != nil {
+			return err
+		}
+		if err := read(page); err != nil {
+			return err
+		}
+
+		var pagination struct {
+			NextURL string `json:"next_url"`
+		}
+		if err := json.Unmarshal(page, &pagination); err != nil {
+			return err
+		}
+		path = pagination.NextURL
+	}
+	return nil
+}
+
+func (b *cliBackend) ListServices() ([]plugin_models.GetServices_Model, error) {
+	return b.cf.GetServices()
+}
+
+func (b *cliBackend) GetService(name string) (plugin_models.GetService_Model, error) {
+	return b.cf.GetService(name)
+}
+
+func (b *cliBackend) CreateService(request ServiceRequest) error {
+	return b.runOnService(request.Name, request.cfCommand(false)...)
+}
+
+func (b *cliBackend) UpdateService(request ServiceRequest) error {
+	return b.runOnService(request.Name, request.cfCommand(true)...)
+}
+
+func (b *cliBackend) DeleteService(name string) error {
+	return b.runOnService(name, deleteServiceCommand(name)...)
+}
+
+// GetServiceTags returns the tags of a service instance
+func (b *cliBackend) GetServiceTags(service plugin_models.GetServices_Model) ([]string, error) {
+	path := "/v2/service_instances/" + service.Guid
+	if service.IsUserProvided {
+		path = "/v2/user_provided_service_instances/" + service.Guid
+	}
+
+	var instance struct {
+		Entity struct {
+			Tags []string `json:"tags"`
+		} `json:"entity"`
+	}
+	if err := b.curl(path, &instance); err != nil {
+		return nil, fmt.Errorf("Unable to read the tags of service %s: %w", service.Name, err)
+	}
+	return instance.Entity.Tags, nil
+}
+
+// GetServiceLabels returns the metadata labels of a service instance
+func (b *cliBackend) GetServiceLabels(guid string) (map[string]string, error) {
+	var instance struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	err := b.curl("/v3/service_instances/"+guid, &instance)
+	return instance.Metadata.Labels, err
+}
+
+// GetServiceCredentials returns the credentials of a user provided service
+func (b *cliBackend) GetServiceCredentials(guid string) (map[string]interface{}, error) {
+	credentials := map[string]interface{}{}
+	err := b.curl("/v3/service_instances/"+guid+"/credentials", &credentials)
+	return credentials, err
+}
+
+// SetServiceMetadata adds to, or changes, the metadata of a service instance
+func (b *cliBackend) SetServiceMetadata(guid string, labels, annotations map[string]string) error {
+	body, err := metadataBody(labels, annotations)
+	if err != nil {
+		return err
+	}
+	path := "/v3/service_instances/" + guid
+	output, err := b.cf.CliCommandWithoutTerminalOutput("curl", "-X", "PATCH", path, "-d", string(body))
+	if err != nil {
+		return err
+	}
+	return curlFailure(path, []byte(strings.Join(output, "\n")))
+}
+
+// metadataBody returns the JSON body of a request that sets metadata. Blank labels or annotations are left out.
+func metadataBody(labels, annotations map[string]string) ([]byte, error) {
+	metadata := map[string]interface{}{}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	return json.Marshal(map[string]interface{}{"metadata": metadata})
+}
+
+// ListServiceKeys returns the names of the keys of a service instance
+func (b *cliBackend) ListServiceKeys(guid string) (map[string]bool, error) {
+	keyNames := map[string]bool{}
+	err := b.curlPages("/v2/service_instances/"+guid+"/service_keys?results-per-page=100", func(page []byte) error {
+		var keys struct {
+			Resources []struct {
+				Entity struct {
+					Name string `json:"name"`
+				} `json:"entity"`
+			} `json:"resources"`
+		}
+		if err := json.Unmarshal(page, &keys); err != nil {
+			return err
+		}
+
+		for _, resource := range keys.Resources {
+			keyNames[resource.Entity.Name] = true
+		}
+		return nil
+	})
+	return keyNames, err
+}
+
+func (b *cliBackend) CreateServiceKey(name, key, parameters string) error {
+	return b.runOnService(name, createServiceKeyCommand(name, key, parameters)...)
+}
+
+func (b *cliBackend) DeleteServiceKey(name, key string) error {
+	return b.runOnService(name, deleteServiceKeyCommand(name, key)...)
+}
+
+// ListShares returns the org/space targets a service instance is shared to
+func (b *cliBackend) ListShares(guid string) (map[string]bool, error) {
+	targets := map[string]bool{}
+	err := b.curlPages("/v2/service_instances/"+guid+"/shared_to?results-per-page=100", func(page []byte) error {
+		var shares struct {
+			Resources []struct {
+				OrganizationName string `json:"organization_name"`
+				SpaceName        string `json:"space_name"`
+			} `json:"resources"`
+		}
+		if err := json.Unmarshal(page, &shares); err != nil {
+			return err
+		}
+
+		for _, resource := range shares.Resources {
+			targets[resource.OrganizationName+"/"+resource.SpaceName] = true
+		}
+		return nil
+	})
+	return targets, err
+}
+
+func (b *cliBackend) ShareService(name, org, space string) error {
+	return b.runOnService(name, shareServiceCommand(name, org, space)...)
+}
+
+func (b *cliBackend) UnshareService(name, org, space string) error {
+	return b.runOnService(name, unshareServiceCommand(name, org, space)...)
+}
+
+func (b *cliBackend) BindService(app, name, parameters string) error {
+	return b.runOnService(name, bindServiceCommand(app, name, parameters)...)
+}
+
+func (b *cliBackend) UnbindService(app, name string) error {
+	return b.runOnService(name, unbindServiceCommand(app, name)...)
+}
+
+func (b *cliBackend) RestageApp(app string) error {
+	return b.run(restageCommand(app)...)
+}
+
+// GetMarketplace returns the offerings in the marketplace of the targeted space, with the plans of those in offerings
+func (b *cliBackend) GetMarketplace(offerings []string) (map[string]map[string]bool, error) {
+	space, err := b.cf.GetCurrentSpace()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, offering := range offerings {
+		wanted[offering] = true
+	}
+
+	plansURLs := map[string]string{}
+	err = b.curlPages("/v2/spaces/"+space.Guid+"/services?results-per-page=100", func(page []byte) error {
+		var services struct {
+			Resources []struct {
+				Entity struct {
+					Label           string `json:"label"`
+					ServicePlansURL string `json:"service_plans_url"`
+				} `json:"entity"`
+			} `json:"resources"`
+		}
+		if err := json.Unmarshal(page, &services); err != nil {
+			return err
+		}
+
+		for _, resource := range services.Resources {
+			plansURLs[resource.Entity.Label] = resource.Entity.ServicePlansURL
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	marketplace := map[string]map[string]bool{}
+	for offering, plansURL := range plansURLs {
+		plans := map[string]bool{}
+		marketplace[offering] = plans
+		if !wanted[offering] {
+			continue
+		}
+
+		err = b.curlPages(plansURL+"?results-per-page=100", func(page []byte) error {
+			var planPage struct {
+				Resources []struct {
+					Entity struct {
+						Name string `json:"name"`
+					} `json:"entity"`
+				} `json:"resources"`
+			}
+			if err := json.Unmarshal(page, &planPage); err != nil {
+				return err
+			}
+
+			for _, plan := range planPage.Resources {
+				plans[plan.Entity.Name] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return marketplace, nil
+}
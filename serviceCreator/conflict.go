@@ -0,0 +1,90 @@
+package serviceCreator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// serviceConflict is the error for a manifest entry that describes a different kind of service, or a service
+// of a different offering, than the existing instance with the same name
+type serviceConflict struct {
+	name        string
+	differences []string
+}
+
+func (e *serviceConflict) Error() string {
+	return fmt.Sprintf("service %s conflicts with the existing instance of the same name: %s",
+		e.name, strings.Join(e.differences, "; "))
+}
+
+// checkConflicts compares the kind, offering and plan of an existing instance with its manifest entry. A different
+// plan alone is plan drift, rather than a conflict. With WarnOnConflicts, a conflicting service is reported and
+// skipped, and true is returned. Otherwise, the conflict is returned as an error.
+func (c *ServiceCreator) checkConflicts(serviceObject serviceManifest.Service) (bool, error) {
+	name := serviceObject.ServiceName
+	existing, exists, err := c.inventory.Find(name)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	existingKind := ""
+	if existing.IsUserProvided {
+		existingKind = "user provided"
+	} else if existing.Service.Name != "" {
+		existingKind = "brokered"
+	}
+	// An instance whose offering isn't listed, e.g., because it has been removed from the marketplace, can't be compared
+	if existingKind == "" {
+		return false, nil
+	}
+
+	kind := "brokered"
+	if serviceObject.Type == "credentials" || serviceObject.Type == "drain" || serviceObject.Type == "route" {
+		kind = "user provided"
+	}
+
+	differences := []string{}
+	if kind != existingKind {
+		differences = append(differences, difference("type", describeKind(serviceObject.Type, kind), existingKind))
+	}
+	if kind != existingKind || (serviceObject.Broker != "" && serviceObject.Broker != existing.Service.Name) {
+		if serviceObject.Broker != existing.Service.Name {
+			differences = append(differences, difference("broker", serviceObject.Broker, existing.Service.Name))
+		}
+		if serviceObject.PlanName != existing.ServicePlan.Name {
+			differences = append(differences, difference("plan", serviceObject.PlanName, existing.ServicePlan.Name))
+		}
+	}
+	if len(differences) == 0 {
+		return false, nil
+	}
+
+	conflict := &serviceConflict{name: name, differences: differences}
+	if !c.options.WarnOnConflicts {
+		return false, conflict
+	}
+
+	fmt.Printf("%s - WARNING: %s. The service is skipped, since --warn-on-conflicts is set\n", name, conflict)
+	c.plan.Add(name, PlanSkip, nil)
+	return true, nil
+}
+
+// difference describes a field that differs between the services manifest and the existing instance
+func difference(field, manifestValue, existingValue string) string {
+	if manifestValue == "" {
+		manifestValue = "none"
+	}
+	if existingValue == "" {
+		existingValue = "none"
+	}
+	return fmt.Sprintf("%s is %s in the services manifest, but %s in the space", field, manifestValue, existingValue)
+}
+
+func describeKind(serviceType, kind string) string {
+	if serviceType == "" || serviceType == "brokered" {
+		return kind
+	}
+	return fmt.Sprintf("%s (%s)", kind, serviceType)
+}
@@ -0,0 +1,121 @@
+package serviceCreator
+
+import (
+	"fmt"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// lastOperationFailure is the error for a service whose last operation failed
+type lastOperationFailure struct {
+	name        string
+	operation   string // The type of the failed operation, e.g., create or update
+	description string
+	existing    bool // The service was already in a failed state before this run
+}
+
+func (f *lastOperationFailure) Error() string {
+	if f.existing {
+		return fmt.Sprintf(
+			"service %s exists, but its last operation failed: %s [status: failed]. Set onFailure to recreate or ignore in the services manifest to recover",
+			f.name, f.description)
+	}
+	return fmt.Sprintf("error %s [status: failed]", f.description)
+}
+
+// checkExistingService inspects the last operation of an existing service. An operation that is still in progress,
+// e.g., from a cancelled run, is waited on before anything else is done to the service. It returns the failure of
+// a service whose last operation failed, or nil if the service doesn't exist or is healthy.
+func (c *ServiceCreator) checkExistingService(serviceObject serviceManifest.Service) (*lastOperationFailure, error) {
+	name := serviceObject.ServiceName
+	serviceExists, err := c.inventory.Exists(name)
+	if err != nil || !serviceExists {
+		return nil, err
+	}
+
+	service, err := c.getService(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if service.LastOperation.State == "in progress" {
+		return c.waitForExistingOperation(serviceObject, service.LastOperation.Type, service.LastOperation.Description)
+	}
+
+	if service.LastOperation.State == "failed" {
+		return &lastOperationFailure{
+			name:        name,
+			operation:   service.LastOperation.Type,
+			description: service.LastOperation.Description,
+			existing:    true,
+		}, nil
+	}
+	return nil, nil
+}
+
+// waitForExistingOperation waits for an operation, that was started before this run, to finish.
+// On a dry run, the operation is only reported.
+func (c *ServiceCreator) waitForExistingOperation(serviceObject serviceManifest.Service, operation, description string) (*lastOperationFailure, error) {
+	name := serviceObject.ServiceName
+	if description == "" {
+		description = "none reported"
+	}
+	fmt.Printf("%s - an earlier %s operation is still in progress. Last reported operation: %s\n", name, operation, description)
+
+	if c.options.DryRun {
+		fmt.Printf("%s - would wait for the %s operation to finish before continuing\n", name, operation)
+		return nil, nil
+	}
+
+	fmt.Printf("%s - waiting for the %s operation to finish before continuing...\n", name, operation)
+	if operation == "delete" {
+		return nil, c.waitForDeletion(serviceObject)
+	}
+
+	poller, err := c.newLastOperationPoller(serviceObject, c.progressReporter)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.waitForService(poller)
+	if failure, failed := err.(*lastOperationFailure); failed {
+		failure.existing = true
+		return failure, nil
+	}
+	return nil, err
+}
+
+// handleFailure applies the onFailure policy of a service to its failed last operation. It returns true if the
+// failure is ignored. With recreate, a service whose create failed is deleted, so that it can be created again.
+// Services whose update failed are never recreated, since deleting them would lose their data.
+func (c *ServiceCreator) handleFailure(serviceObject serviceManifest.Service, failure *lastOperationFailure) (bool, error) {
+	switch serviceObject.OnFailure {
+	case "ignore":
+		fmt.Printf("%s - WARNING: %s. The failure is ignored, since onFailure is ignore\n", serviceObject.ServiceName, failure)
+		return true, nil
+	case "recreate":
+		if failure.operation == "create" {
+			return false, c.deleteService(pruneCandidate{service: serviceObject, reason: "failed to be created"})
+		}
+	}
+	return false, failure
+}
+
+// recoverFromFailure applies the onFailure policy to a service whose operation failed during this run.
+// With recreate, the service is created again, once, and waited on. It returns true if the failure is ignored.
+func (c *ServiceCreator) recoverFromFailure(serviceObject serviceManifest.Service, failure *lastOperationFailure) (bool, error) {
+	ignored, err := c.handleFailure(serviceObject, failure)
+	if err != nil || ignored {
+		return ignored, err
+	}
+
+	outcome, err := c.provisionService(serviceObject)
+	if err == nil && outcome == provisionInProgress {
+		var poller *lastOperationPoller
+		poller, err = c.newLastOperationPoller(serviceObject, c.progressReporter)
+		if err == nil {
+			err = c.waitForService(poller)
+		}
+	}
+	return false, err
+}
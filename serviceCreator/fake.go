@@ -0,0 +1,511 @@
+package serviceCreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// FakeFailureParameter is the parameter that makes an operation on a brokered service, on the fake foundation, fail
+// with its value as the description, e.g., {"fake-failure": "out of capacity"}
+const FakeFailureParameter = "fake-failure"
+
+// FakeBackend is an in-memory foundation, for unit tests and for trying out a services manifest with --backend fake.
+// Like a real broker, operations on brokered services are asynchronous. They stay in progress for PollsToComplete
+// polls of GetService, and then succeed, unless their parameters hold FakeFailureParameter.
+type FakeBackend struct {
+	Marketplace     map[string][]string // The plans of each service offering, by name
+	PollsToComplete int                 // 0 completes operations on the first poll
+	Services        []*FakeService
+	NextGUID        int
+	StateFile       string `json:"-"` // When set, the foundation is saved to this file after every change
+}
+
+// FakeService is a service instance on the fake foundation
+type FakeService struct {
+	GUID           string
+	Name           string
+	Type           string // brokered, credentials, drain or route
+	Offering       string
+	Plan           string
+	Parameters     string
+	Credentials    string
+	URL            string
+	Tags           []string
+	Labels         map[string]string
+	Annotations    map[string]string
+	LastOperation  plugin_models.GetService_LastOperation
+	PendingPolls   int    // How many more polls the operation in progress takes
+	PendingFailure string // The description the operation in progress fails with, if it fails
+	Keys           []string
+	Shares         []string // org/space targets
+	Apps           []string // Names of the bound apps
+}
+
+// NewFakeBackend creates an empty fake foundation with a marketplace of commonly used service offerings
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		Marketplace: map[string][]string{
+			"p-mysql":            {"100mb", "1gb", "small", "large"},
+			"p-redis":            {"shared", "dedicated"},
+			"p-rabbitmq":         {"standard"},
+			"p-config-server":    {"standard"},
+			"p-service-registry": {"standard"},
+		},
+		PollsToComplete: 2,
+		Services:        []*FakeService{},
+	}
+}
+
+// LoadFakeBackend creates a fake foundation that is kept in stateFile, so that it outlives a run. The file is
+// created on the first change. A blank stateFile keeps the foundation in memory only.
+func LoadFakeBackend(stateFile string) (*FakeBackend, error) {
+	f := NewFakeBackend()
+	f.StateFile = stateFile
+	if stateFile == "" {
+		return f, nil
+	}
+
+	state, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(state, f); err != nil {
+		return nil, fmt.Errorf("the fake foundation in %s can not be read: %s", stateFile, err)
+	}
+	return f, nil
+}
+
+func (f *FakeBackend) save() error {
+	if f.StateFile == "" {
+		return nil
+	}
+
+	state, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.StateFile, state, 0644)
+}
+
+func (f *FakeBackend) log(args []string) {
+	fmt.Printf("Now Running on the fake foundation: %s\n", strings.Join(args, " "))
+}
+
+// Find returns the named service instance, or nil if it doesn't exist
+func (f *FakeBackend) Find(name string) *FakeService {
+	for _, service := range f.Services {
+		if service.Name == name {
+			return service
+		}
+	}
+	return nil
+}
+
+func (f *FakeBackend) findGUID(guid string) (*FakeService, error) {
+	for _, service := range f.Services {
+		if service.GUID == guid {
+			return service, nil
+		}
+	}
+	return nil, fmt.Errorf("Service instance %s not found", guid)
+}
+
+func (f *FakeBackend) mustFind(name string) (*FakeService, error) {
+	if service := f.Find(name); service != nil {
+		return service, nil
+	}
+	return nil, fmt.Errorf("Service instance %s not found", name)
+}
+
+func (f *FakeBackend) remove(name string) {
+	services := []*FakeService{}
+	for _, service := range f.Services {
+		if service.Name != name {
+			services = append(services, service)
+		}
+	}
+	f.Services = services
+}
+
+// start begins an asynchronous operation on a brokered service
+func (f *FakeBackend) start(service *FakeService, operation, parameters string) {
+	service.LastOperation = plugin_models.GetService_LastOperation{Type: operation, State: "in progress", Description: operation + " in progress"}
+	service.PendingPolls = f.PollsToComplete
+	service.PendingFailure = ""
+
+	var decodedParameters map[string]interface{}
+	if json.Unmarshal([]byte(parameters), &decodedParameters) == nil && decodedParameters[FakeFailureParameter] != nil {
+		service.PendingFailure = fmt.Sprintf("%v", decodedParameters[FakeFailureParameter])
+	}
+
+	if service.PendingPolls <= 0 {
+		f.complete(service)
+	}
+}
+
+// complete ends the operation in progress on a service. A service whose deletion succeeded is removed.
+func (f *FakeBackend) complete(service *FakeService) {
+	operation := service.LastOperation.Type
+	service.PendingPolls = 0
+	if service.PendingFailure != "" {
+		service.LastOperation.State = "failed"
+		service.LastOperation.Description = service.PendingFailure
+		service.PendingFailure = ""
+		return
+	}
+
+	service.LastOperation.State = "succeeded"
+	service.LastOperation.Description = operation + " succeeded"
+	if operation == "delete" {
+		f.remove(service.Name)
+	}
+}
+
+func (f *FakeBackend) checkPlan(offering, plan string) error {
+	plans, offered := f.Marketplace[offering]
+	if !offered {
+		return fmt.Errorf("Service offering %s not found", offering)
+	}
+	for _, offeredPlan := range plans {
+		if offeredPlan == plan {
+			return nil
+		}
+	}
+	return fmt.Errorf("The plan %s could not be found for service offering %s", plan, offering)
+}
+
+func checkNotInProgress(service *FakeService) error {
+	if service.LastOperation.State == "in progress" {
+		return fmt.Errorf("An operation for service instance %s is in progress.", service.Name)
+	}
+	return nil
+}
+
+func (f *FakeBackend) ListServices() ([]plugin_models.GetServices_Model, error) {
+	services := []plugin_models.GetServices_Model{}
+	for _, service := range f.Services {
+		services = append(services, plugin_models.GetServices_Model{
+			Guid:             service.GUID,
+			Name:             service.Name,
+			ServicePlan:      plugin_models.GetServices_ServicePlan{Name: service.Plan},
+			Service:          plugin_models.GetServices_ServiceFields{Name: service.Offering},
+			LastOperation:    plugin_models.GetServices_LastOperation{Type: service.LastOperation.Type, State: service.LastOperation.State},
+			ApplicationNames: append([]string{}, service.Apps...),
+			IsUserProvided:   service.Type != "brokered",
+		})
+	}
+	return services, nil
+}
+
+// GetService gets the named service instance. Each call is a poll, which brings the operation in progress closer to completion.
+func (f *FakeBackend) GetService(name string) (plugin_models.GetService_Model, error) {
+	service, err := f.mustFind(name)
+	if err != nil {
+		return plugin_models.GetService_Model{}, err
+	}
+
+	if service.PendingPolls > 0 {
+		service.PendingPolls--
+		if service.PendingPolls == 0 {
+			f.complete(service)
+		}
+		if err = f.save(); err != nil {
+			return plugin_models.GetService_Model{}, err
+		}
+	}
+
+	return plugin_models.GetService_Model{
+		Guid:            service.GUID,
+		Name:            service.Name,
+		IsUserProvided:  service.Type != "brokered",
+		ServiceOffering: plugin_models.GetService_ServiceFields{Name: service.Offering},
+		ServicePlan:     plugin_models.GetService_ServicePlan{Name: service.Plan},
+		LastOperation:   service.LastOperation,
+	}, nil
+}
+
+// CreateService creates a service instance. User provided services are created at once.
+func (f *FakeBackend) CreateService(request ServiceRequest) error {
+	f.log(request.cfCommand(false))
+	if f.Find(request.Name) != nil {
+		return fmt.Errorf("The service instance name is taken: %s", request.Name)
+	}
+
+	f.NextGUID++
+	service := &FakeService{
+		GUID:        fmt.Sprintf("fake-guid-%d", f.NextGUID),
+		Name:        request.Name,
+		Type:        request.Type,
+		Credentials: request.Credentials,
+		URL:         request.URL,
+		Tags:        splitTags(request.Tags),
+	}
+
+	if request.isUserProvided() {
+		service.LastOperation = plugin_models.GetService_LastOperation{Type: "create", State: "succeeded", Description: "create succeeded"}
+	} else {
+		if err := f.checkPlan(request.Broker, request.Plan); err != nil {
+			return err
+		}
+		service.Type = "brokered"
+		service.Offering = request.Broker
+		service.Plan = request.Plan
+		service.Parameters = request.Parameters
+		f.start(service, "create", request.Parameters)
+	}
+
+	f.Services = append(f.Services, service)
+	return f.save()
+}
+
+// UpdateService updates a service instance. Only what is in the request is changed.
+func (f *FakeBackend) UpdateService(request ServiceRequest) error {
+	f.log(request.cfCommand(true))
+	service, err := f.mustFind(request.Name)
+	if err != nil {
+		return err
+	}
+	if err = checkNotInProgress(service); err != nil {
+		return err
+	}
+
+	if request.Tags != "" {
+		service.Tags = splitTags(request.Tags)
+	}
+
+	if request.isUserProvided() {
+		if request.Credentials != "" {
+			service.Credentials = request.Credentials
+		}
+		if request.URL != "" {
+			service.URL = request.URL
+		}
+		service.LastOperation = plugin_models.GetService_LastOperation{Type: "update", State: "succeeded", Description: "update succeeded"}
+		return f.save()
+	}
+
+	if request.Plan != "" {
+		if err = f.checkPlan(service.Offering, request.Plan); err != nil {
+			return err
+		}
+		service.Plan = request.Plan
+	}
+	if request.Parameters != "" {
+		service.Parameters = request.Parameters
+	}
+	f.start(service, "update", request.Parameters)
+	return f.save()
+}
+
+// DeleteService deletes a service instance that has no bound apps, keys or shares. Deleting a service that doesn't exist
+// succeeds.
+func (f *FakeBackend) DeleteService(name string) error {
+	f.log(deleteServiceCommand(name))
+	service := f.Find(name)
+	if service == nil {
+		return nil
+	}
+	if err := checkNotInProgress(service); err != nil {
+		return err
+	}
+	if len(service.Apps) > 0 {
+		return fmt.Errorf("Cannot delete service instance %s, it is bound to %s", name, strings.Join(service.Apps, ", "))
+	}
+	if len(service.Keys) > 0 {
+		return fmt.Errorf("Cannot delete service instance %s, it has service keys %s", name, strings.Join(service.Keys, ", "))
+	}
+	if len(service.Shares) > 0 {
+		return fmt.Errorf("Cannot delete service instance %s, it is shared to %s", name, strings.Join(service.Shares, ", "))
+	}
+
+	if service.Type == "brokered" {
+		f.start(service, "delete", "")
+	} else {
+		f.remove(name)
+	}
+	return f.save()
+}
+
+func (f *FakeBackend) GetServiceTags(serviceModel plugin_models.GetServices_Model) ([]string, error) {
+	service, err := f.findGUID(serviceModel.Guid)
+	if err != nil {
+		return nil, err
+	}
+	return service.Tags, nil
+}
+
+func (f *FakeBackend) GetServiceLabels(guid string) (map[string]string, error) {
+	service, err := f.findGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	return service.Labels, nil
+}
+
+func (f *FakeBackend) GetServiceCredentials(guid string) (map[string]interface{}, error) {
+	service, err := f.findGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := map[string]interface{}{}
+	if service.Credentials != "" {
+		err = json.Unmarshal([]byte(service.Credentials), &credentials)
+	}
+	return credentials, err
+}
+
+func (f *FakeBackend) SetServiceMetadata(guid string, labels, annotations map[string]string) error {
+	service, err := f.findGUID(guid)
+	if err != nil {
+		return err
+	}
+
+	if service.Labels == nil {
+		service.Labels = map[string]string{}
+	}
+	for key, value := range labels {
+		service.Labels[key] = value
+	}
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		service.Annotations[key] = value
+	}
+	return f.save()
+}
+
+func (f *FakeBackend) ListServiceKeys(guid string) (map[string]bool, error) {
+	service, err := f.findGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	return toSet(service.Keys), nil
+}
+
+func (f *FakeBackend) CreateServiceKey(name, key, parameters string) error {
+	f.log(createServiceKeyCommand(name, key, parameters))
+	service, err := f.mustFind(name)
+	if err != nil {
+		return err
+	}
+	if toSet(service.Keys)[key] {
+		return fmt.Errorf("The service key name is taken: %s", key)
+	}
+
+	service.Keys = append(service.Keys, key)
+	return f.save()
+}
+
+func (f *FakeBackend) DeleteServiceKey(name, key string) error {
+	f.log(deleteServiceKeyCommand(name, key))
+	service, err := f.mustFind(name)
+	if err != nil {
+		return err
+	}
+
+	service.Keys = without(service.Keys, key)
+	return f.save()
+}
+
+func (f *FakeBackend) ListShares(guid string) (map[string]bool, error) {
+	service, err := f.findGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	return toSet(service.Shares), nil
+}
+
+func (f *FakeBackend) ShareService(name, org, space string) error {
+	f.log(shareServiceCommand(name, org, space))
+	service, err := f.mustFind(name)
+	if err != nil {
+		return err
+	}
+	if service.Type != "brokered" {
+		return fmt.Errorf("User-provided services cannot be shared")
+	}
+
+	if target := org + "/" + space; !toSet(service.Shares)[target] {
+		service.Shares = append(service.Shares, target)
+	}
+	return f.save()
+}
+
+func (f *FakeBackend) UnshareService(name, org, space string) error {
+	f.log(unshareServiceCommand(name, org, space))
+	service, err := f.mustFind(name)
+	if err != nil {
+		return err
+	}
+
+	service.Shares = without(service.Shares, org+"/"+space)
+	return f.save()
+}
+
+// BindService binds a service instance to an app. Every app is taken to exist.
+func (f *FakeBackend) BindService(app, name, parameters string) error {
+	f.log(bindServiceCommand(app, name, parameters))
+	service, err := f.mustFind(name)
+	if err != nil {
+		return err
+	}
+	if toSet(service.Apps)[app] {
+		return fmt.Errorf("App %s is already bound to %s", app, name)
+	}
+
+	service.Apps = append(service.Apps, app)
+	return f.save()
+}
+
+func (f *FakeBackend) UnbindService(app, name string) error {
+	f.log(unbindServiceCommand(app, name))
+	service, err := f.mustFind(name)
+	if err != nil {
+		return err
+	}
+
+	service.Apps = without(service.Apps, app)
+	return f.save()
+}
+
+// RestageApp does nothing, since the fake foundation has no apps
+func (f *FakeBackend) RestageApp(app string) error {
+	f.log(restageCommand(app))
+	return nil
+}
+
+func (f *FakeBackend) GetMarketplace(offerings []string) (map[string]map[string]bool, error) {
+	marketplace := map[string]map[string]bool{}
+	for offering, plans := range f.Marketplace {
+		marketplace[offering] = toSet(plans)
+	}
+	return marketplace, nil
+}
+
+func toSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func without(values []string, value string) []string {
+	remaining := []string{}
+	for _, candidate := range values {
+		if candidate != value {
+			remaining = append(remaining, candidate)
+		}
+	}
+	return remaining
+}
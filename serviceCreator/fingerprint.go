@@ -0,0 +1,156 @@
+package serviceCreator
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// FingerprintLabel is the metadata label, on a service instance, that holds the fingerprint of the
+// manifest entry that was last applied to it. Services with updateService set are only updated when
+// the fingerprint of their manifest entry differs from this label.
+const FingerprintLabel = "create-service-push-fingerprint"
+
+// fingerprint returns a hash of everything in a manifest entry that create or update would pass to cf, other than
+// credentials. The fingerprint can be read by anyone who can see the service, so credentials, which could be guessed
+// from it, are left out and compared with those of the service instead.
+func (c *ServiceCreator) fingerprint(serviceObject serviceManifest.Service) (string, error) {
+	parameters := serviceObject.JSONParameters
+	if parameters != "" {
+		// Parameters are normalised, so that formatting alone is not seen as a change
+		var decodedParameters interface{}
+		if err := json.Unmarshal([]byte(parameters), &decodedParameters); err == nil {
+			normalisedParameters, _ := json.Marshal(decodedParameters)
+			parameters = string(normalisedParameters)
+		}
+	}
+
+	desiredState, err := json.Marshal(struct {
+		Type        string            `json:"type"`
+		Broker      string            `json:"broker"`
+		Plan        string            `json:"plan"`
+		URL         string            `json:"url"`
+		Parameters  string            `json:"parameters"`
+		Tags        []string          `json:"tags"`
+		Labels      map[string]string `json:"labels,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}{
+		Type:        serviceObject.Type,
+		Broker:      serviceObject.Broker,
+		Plan:        serviceObject.PlanName,
+		URL:         serviceObject.URL,
+		Parameters:  parameters,
+		Tags:        c.tagArgs(serviceObject.Tags),
+		Labels:      serviceObject.Labels,
+		Annotations: serviceObject.Annotations,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha1.Sum(desiredState)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// isUnchanged returns true if an existing service carries the fingerprint of its manifest entry, and for
+// brokered services, is still on the plan in the manifest, or for credentials services, still has the credentials
+// in the manifest. Any failure to read the fingerprint is treated as a change, so that the service is updated as
+// it would be without fingerprints.
+func (c *ServiceCreator) isUnchanged(serviceObject serviceManifest.Service) bool {
+	name := serviceObject.ServiceName
+	serviceExists, err := c.inventory.Exists(name)
+	if err != nil || !serviceExists {
+		return false
+	}
+
+	service, err := c.getService(name)
+	if err != nil || service.Guid == "" {
+		return false
+	}
+	if serviceObject.PlanName != "" && service.ServicePlan.Name != "" && service.ServicePlan.Name != serviceObject.PlanName {
+		return false
+	}
+
+	var labels map[string]string
+	err = c.withRetries(name, "reading its labels", func() error {
+		labels, err = c.backend.GetServiceLabels(service.Guid)
+		return err
+	})
+	if err != nil {
+		return false
+	}
+
+	fingerprint, err := c.fingerprint(serviceObject)
+	if err != nil || labels[FingerprintLabel] != fingerprint {
+		return false
+	}
+
+	if serviceObject.Type == "credentials" {
+		return c.hasCredentials(name, service.Guid, serviceObject.Credentials)
+	}
+	return true
+}
+
+// hasCredentials returns true if a user provided service has the given credentials
+func (c *ServiceCreator) hasCredentials(name, guid string, credentials interface{}) bool {
+	var existingCredentials map[string]interface{}
+	err := c.withRetries(name, "reading its credentials", func() error {
+		var err error
+		existingCredentials, err = c.backend.GetServiceCredentials(guid)
+		return err
+	})
+	if err != nil {
+		return false
+	}
+
+	if credentials == nil {
+		credentials = map[string]interface{}{}
+	}
+
+	// Both are marshalled to JSON, which orders keys, so that they compare equal regardless of how they were decoded
+	existingJSON, err := json.Marshal(existingCredentials)
+	if err != nil {
+		return false
+	}
+	desiredJSON, err := json.Marshal(credentials)
+	return err == nil && string(existingJSON) == string(desiredJSON)
+}
+
+// recordFingerprint labels a service, that was just created or updated, with the fingerprint of its manifest entry.
+// Only services with updateService set are labelled, since other services are never updated.
+func (c *ServiceCreator) recordFingerprint(serviceObject serviceManifest.Service) {
+	action := c.plan.Action(serviceObject.ServiceName)
+	if !serviceObject.UpdateService || c.options.DryRun || (action != PlanCreate && action != PlanUpdate) {
+		return
+	}
+
+	// The service itself is in the desired state, so failing to record the fingerprint only means it is updated again next time
+	if err := c.labelFingerprint(serviceObject); err != nil {
+		fmt.Printf("WARNING: Unable to record the fingerprint of service %s. It will be updated again on the next run: %s\n", serviceObject.ServiceName, err)
+	}
+}
+
+func (c *ServiceCreator) labelFingerprint(serviceObject serviceManifest.Service) error {
+	fingerprint, err := c.fingerprint(serviceObject)
+	if err != nil {
+		return err
+	}
+
+	service, err := c.getService(serviceObject.ServiceName)
+	if err != nil {
+		return err
+	}
+
+	return c.withRetries(serviceObject.ServiceName, "labelling its fingerprint", func() error {
+		return c.backend.SetServiceMetadata(service.Guid, map[string]string{FingerprintLabel: fingerprint}, nil)
+	})
+}
+
+// unchanged records that the service matches its manifest entry and needs no update
+func (c *ServiceCreator) unchanged(name string) {
+	fmt.Printf("%s - unchanged since it was last updated...skipping update\n", name)
+	c.plan.Add(name, PlanUnchanged, nil)
+}
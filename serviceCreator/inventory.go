@@ -0,0 +1,97 @@
+package serviceCreator
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// Inventory is the list of service instances in the targeted space. It is loaded once, on first use, rather
+// than once per service, and is loaded again after any cf command that may have changed the space.
+type Inventory struct {
+	list     func(name string) ([]plugin_models.GetServices_Model, error)
+	services map[string]plugin_models.GetServices_Model
+	order    []string
+	loaded   bool
+}
+
+// NewInventory creates an inventory that loads the service instances with list.
+// The name passed to list is that of the service the instances are loaded on behalf of.
+func NewInventory(list func(name string) ([]plugin_models.GetServices_Model, error)) *Inventory {
+	return &Inventory{list: list}
+}
+
+// Invalidate discards the loaded instances, so that they are loaded again when next used
+func (i *Inventory) Invalidate() {
+	i.loaded = false
+	i.services = nil
+	i.order = nil
+}
+
+func (i *Inventory) load(name string) error {
+	if i.loaded {
+		return nil
+	}
+
+	services, err := i.list(name)
+	if err != nil {
+		return err
+	}
+
+	i.services = map[string]plugin_models.GetServices_Model{}
+	i.order = []string{}
+	for _, service := range services {
+		if _, exists := i.services[service.Name]; !exists {
+			i.order = append(i.order, service.Name)
+		}
+		i.services[service.Name] = service
+	}
+	i.loaded = true
+	return nil
+}
+
+// All returns every service instance in the space, in the order they were listed
+func (i *Inventory) All() ([]plugin_models.GetServices_Model, error) {
+	if err := i.load(""); err != nil {
+		return nil, err
+	}
+
+	services := []plugin_models.GetServices_Model{}
+	for _, name := range i.order {
+		services = append(services, i.services[name])
+	}
+	return services, nil
+}
+
+// Find returns the named service instance, and whether it exists
+func (i *Inventory) Find(name string) (plugin_models.GetServices_Model, bool, error) {
+	if err := i.load(name); err != nil {
+		return plugin_models.GetServices_Model{}, false, err
+	}
+
+	service, exists := i.services[name]
+	return service, exists, nil
+}
+
+// Exists returns true if the named service instance exists
+func (i *Inventory) Exists(name string) (bool, error) {
+	_, exists, err := i.Find(name)
+	return exists, err
+}
+
+// IsUserProvided returns true if the named service instance exists and is a user provided service
+func (i *Inventory) IsUserProvided(name string) (bool, error) {
+	service, exists, err := i.Find(name)
+	return exists && service.IsUserProvided, err
+}
+
+// Plan returns the name of the plan of the named service instance, or blank if it doesn't exist or is user provided
+func (i *Inventory) Plan(name string) (string, error) {
+	service, _, err := i.Find(name)
+	return service.ServicePlan.Name, err
+}
+
+// Broker returns the name of the service offering, i.e., the broker in the services manifest, of the named
+// service instance. It is blank if the instance doesn't exist or is user provided.
+func (i *Inventory) Broker(name string) (string, error) {
+	service, _, err := i.Find(name)
+	return service.Service.Name, err
+}
@@ -0,0 +1,112 @@
+package serviceCreator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// CheckMarketplace verifies that the broker and plan of every brokered service in the manifest are offered in the
+// marketplace of the targeted space, i.e., are visible to its org. Nothing is created or changed.
+func (c *ServiceCreator) CheckMarketplace(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options Options) error {
+
+	checkMarketplaceobject := &ServiceCreator{
+		manifest:         manifest,
+		cf:               cf,
+		progressReporter: NewProgressReporter(),
+		options:          options,
+		plan:             NewPlan(),
+		backend:          c.backend,
+	}
+	checkMarketplaceobject.inventory = NewInventory(checkMarketplaceobject.getServices)
+	if err := checkMarketplaceobject.connectBackend(); err != nil {
+		return err
+	}
+
+	return checkMarketplaceobject.checkMarketplace()
+}
+
+func (c *ServiceCreator) checkMarketplace() error {
+	offerings, err := c.getMarketplace()
+	if err != nil {
+		return err
+	}
+
+	brokers := []string{}
+	for broker := range offerings {
+		brokers = append(brokers, broker)
+	}
+	sort.Strings(brokers)
+
+	problems := []string{}
+	for _, serviceObject := range c.manifest.Services {
+		if (serviceObject.Type != "" && serviceObject.Type != "brokered") || serviceObject.State == "absent" {
+			continue
+		}
+
+		// An existing service on the broker and plan in the manifest needs nothing from the marketplace, even
+		// if its plan has since been withdrawn
+		existing, exists, err := c.inventory.Find(serviceObject.ServiceName)
+		if err != nil {
+			return err
+		}
+		if exists && existing.Service.Name == serviceObject.Broker && existing.ServicePlan.Name == serviceObject.PlanName {
+			continue
+		}
+
+		plans, offered := offerings[serviceObject.Broker]
+		if !offered {
+			problems = append(problems, fmt.Sprintf("service %s: broker %s is not in the marketplace%s",
+				serviceObject.ServiceName, serviceObject.Broker, suggestion(serviceObject.Broker, brokers)))
+			continue
+		}
+
+		if !plans[serviceObject.PlanName] {
+			planNames := sortedKeys(plans)
+			problems = append(problems, fmt.Sprintf("service %s: plan %s is not offered by broker %s. Its plans are %s%s",
+				serviceObject.ServiceName, serviceObject.PlanName, serviceObject.Broker,
+				strings.Join(planNames, ", "), suggestion(serviceObject.PlanName, planNames)))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the marketplace of the targeted space does not offer every service in the services manifest:\n  %s",
+			strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// getMarketplace returns the plans of each service offering, by name, that is visible in the targeted space
+func (c *ServiceCreator) getMarketplace() (map[string]map[string]bool, error) {
+	offerings := []string{}
+	for _, serviceObject := range c.manifest.Services {
+		offerings = append(offerings, serviceObject.Broker)
+	}
+	var marketplace map[string]map[string]bool
+	err := c.withRetries("", "cf marketplace", func() error {
+		var err error
+		marketplace, err = c.backend.GetMarketplace(offerings)
+		return err
+	})
+	return marketplace, err
+}
+
+// suggestion returns a question suggesting the closest match to a misspelt name, or blank if there is none
+func suggestion(name string, candidates []string) string {
+	if closest := serviceManifest.ClosestMatch(name, candidates); closest != "" {
+		return fmt.Sprintf(". Did you mean %s?", closest)
+	}
+	return ""
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
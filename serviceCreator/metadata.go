@@ -0,0 +1,29 @@
+package serviceCreator
+
+import (
+	"fmt"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// recordMetadata sets the labels and annotations in the manifest entry of a service that was just created or updated.
+// Labels and annotations that are no longer in the manifest entry are left on the service.
+func (c *ServiceCreator) recordMetadata(serviceObject serviceManifest.Service) error {
+	action := c.plan.Action(serviceObject.ServiceName)
+	if c.options.DryRun || (action != PlanCreate && action != PlanUpdate) ||
+		(len(serviceObject.Labels) == 0 && len(serviceObject.Annotations) == 0) {
+		return nil
+	}
+
+	service, err := c.getService(serviceObject.ServiceName)
+	if err == nil {
+		err = c.withRetries(serviceObject.ServiceName, "setting its labels and annotations", func() error {
+			return c.backend.SetServiceMetadata(service.Guid, serviceObject.Labels, serviceObject.Annotations)
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to set the labels and annotations of service %s: %s", serviceObject.ServiceName, err)
+	}
+	return nil
+}
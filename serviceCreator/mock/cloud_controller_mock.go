@@ -0,0 +1,85 @@
+package serviceCreatorMock
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+)
+
+// MockRequest is a request received by the mock Cloud Controller
+type MockRequest struct {
+	Method        string
+	Path          string
+	Query         string
+	Body          string
+	Authorization string
+}
+
+// MockResponse is a canned response of the mock Cloud Controller
+type MockResponse struct {
+	Status   int // 0 is 200 OK
+	Body     string
+	Location string
+}
+
+// MockCloudController serves canned responses for the Cloud Controller v3 API over HTTP
+type MockCloudController struct {
+	Server    *httptest.Server
+	Requests  []MockRequest
+	Responses map[string][]MockResponse // By method and path, e.g., "GET /v3/service_instances". Returned one per request, and the last one repeats.
+}
+
+func NewMockCloudController() *MockCloudController {
+	mcc := &MockCloudController{Responses: map[string][]MockResponse{}}
+	mcc.Server = httptest.NewServer(http.HandlerFunc(mcc.serve))
+	return mcc
+}
+
+func (mcc *MockCloudController) Close() {
+	mcc.Server.Close()
+}
+
+// RequestsTo returns the requests received for a method and path, e.g., "POST /v3/service_instances"
+func (mcc *MockCloudController) RequestsTo(methodAndPath string) []MockRequest {
+	requests := []MockRequest{}
+	for _, request := range mcc.Requests {
+		if request.Method+" "+request.Path == methodAndPath {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func (mcc *MockCloudController) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	mcc.Requests = append(mcc.Requests, MockRequest{
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Query:         r.URL.RawQuery,
+		Body:          string(body),
+		Authorization: r.Header.Get("Authorization"),
+	})
+
+	key := r.Method + " " + r.URL.Path
+	responses := mcc.Responses[key]
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[{"detail":"Unknown request","title":"CF-NotFound","code":10000}]}`))
+		return
+	}
+
+	response := responses[0]
+	if len(responses) > 1 {
+		mcc.Responses[key] = responses[1:]
+	}
+
+	if response.Location != "" {
+		w.Header().Set("Location", response.Location)
+	}
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(response.Body))
+}
@@ -7,16 +7,28 @@ import (
 )
 
 type MockCliConnection struct {
-	CommandOutput []string
+	CommandOutput        []string
+	CommandHistory       [][]string
+	SilentCommandHistory [][]string
 
-	GetServicesModels []plugin_models.GetServices_Model
+	GetServicesModels    []plugin_models.GetServices_Model
+	GetServicesCallCount int
 
 	GetServiceExists                bool
 	GetServiceModel                 plugin_models.GetService_Model
+	GetServiceModelsByName          map[string]plugin_models.GetService_Model
+	CurlResponses                   map[string]string
 	CliCommandWasCalled             bool
 	SimulateErrorOnGetServices      bool
 	SimulateErrorOnGetServiceByName bool
 	SimulateErrorOnCliCommand       bool
+	CliCommandErrors                []error                          // Returned, one per call, before any other outcome of CliCommand
+	GetServiceErrors                []error                          // Returned, one per call, before any other outcome of GetService
+	GetServiceModelQueue            []plugin_models.GetService_Model // Returned, one per call, before GetServiceModel when GetServiceExists
+	CreatedServiceModel             *plugin_models.GetService_Model  // When set, the model GetService returns for services created by create-service
+	APIEndpoint                     string
+	AccessTokenValue                string
+	CurrentSpace                    plugin_models.Space
 }
 
 func NewMockCliConnection() *MockCliConnection {
@@ -24,6 +36,12 @@ func NewMockCliConnection() *MockCliConnection {
 }
 
 func (mc *MockCliConnection) CliCommandWithoutTerminalOutput(args ...string) ([]string, error) {
+	mc.SilentCommandHistory = append(mc.SilentCommandHistory, args)
+	if len(args) == 2 && args[0] == "curl" {
+		if response, exists := mc.CurlResponses[args[1]]; exists {
+			return []string{response}, nil
+		}
+	}
 	return nil, nil
 }
 func (mc *MockCliConnection) CliCommand(args ...string) ([]string, error) {
@@ -36,6 +54,31 @@ func (mc *MockCliConnection) CliCommand(args ...string) ([]string, error) {
 		argArray = append(argArray, argElement)
 	}
 	mc.CommandOutput = argArray
+	mc.CommandHistory = append(mc.CommandHistory, argArray)
+
+	if len(mc.CliCommandErrors) > 0 {
+		err = mc.CliCommandErrors[0]
+		mc.CliCommandErrors = mc.CliCommandErrors[1:]
+		return argArray, err
+	}
+
+	if len(args) > 3 && args[0] == "create-service" && mc.CreatedServiceModel != nil {
+		if mc.GetServiceModelsByName == nil {
+			mc.GetServiceModelsByName = map[string]plugin_models.GetService_Model{}
+		}
+		mc.GetServiceModelsByName[args[3]] = *mc.CreatedServiceModel
+	}
+
+	// Deleting a service removes it from the list of services
+	if len(args) > 1 && args[0] == "delete-service" && !mc.SimulateErrorOnCliCommand {
+		remainingServices := []plugin_models.GetServices_Model{}
+		for _, service := range mc.GetServicesModels {
+			if service.Name != args[1] {
+				remainingServices = append(remainingServices, service)
+			}
+		}
+		mc.GetServicesModels = remainingServices
+	}
 
 	if mc.SimulateErrorOnCliCommand {
 		err = fmt.Errorf("SimulateErrorOnCliCommand == true")
@@ -46,7 +89,7 @@ func (mc *MockCliConnection) GetCurrentOrg() (plugin_models.Organization, error)
 	return plugin_models.Organization{}, nil
 }
 func (mc *MockCliConnection) GetCurrentSpace() (plugin_models.Space, error) {
-	return plugin_models.Space{}, nil
+	return mc.CurrentSpace, nil
 }
 func (mc *MockCliConnection) Username() (string, error)  { return "", nil }
 func (mc *MockCliConnection) UserGuid() (string, error)  { return "", nil }
@@ -59,12 +102,12 @@ func (mc *MockCliConnection) IsLoggedIn() (bool, error)  { return false, nil }
 func (mc *MockCliConnection) IsSSLDisabled() (bool, error)         { return false, nil }
 func (mc *MockCliConnection) HasOrganization() (bool, error)       { return false, nil }
 func (mc *MockCliConnection) HasSpace() (bool, error)              { return false, nil }
-func (mc *MockCliConnection) ApiEndpoint() (string, error)         { return "", nil }
+func (mc *MockCliConnection) ApiEndpoint() (string, error)         { return mc.APIEndpoint, nil }
 func (mc *MockCliConnection) ApiVersion() (string, error)          { return "", nil }
 func (mc *MockCliConnection) HasAPIEndpoint() (bool, error)        { return false, nil }
 func (mc *MockCliConnection) LoggregatorEndpoint() (string, error) { return "", nil }
 func (mc *MockCliConnection) DopplerEndpoint() (string, error)     { return "", nil }
-func (mc *MockCliConnection) AccessToken() (string, error)         { return "", nil }
+func (mc *MockCliConnection) AccessToken() (string, error)         { return mc.AccessTokenValue, nil }
 func (mc *MockCliConnection) GetApp(string) (plugin_models.GetAppModel, error) {
 	return plugin_models.GetAppModel{}, nil
 }
@@ -95,18 +138,31 @@ func (mc *MockCliConnection) GetSpaceUsers(string, string) ([]plugin_models.GetS
 }
 func (mc *MockCliConnection) GetServices() ([]plugin_models.GetServices_Model, error) {
 	var err error
+	mc.GetServicesCallCount++
 	if mc.SimulateErrorOnGetServices {
 		err = fmt.Errorf("SimulateErrorOnGetServices = true")
 	}
 
 	return mc.GetServicesModels, err
 }
-func (mc *MockCliConnection) GetService(string) (plugin_models.GetService_Model, error) {
+func (mc *MockCliConnection) GetService(name string) (plugin_models.GetService_Model, error) {
 
 	var err error
 	serviceModel := plugin_models.GetService_Model{}
-	if mc.GetServiceExists {
+	if len(mc.GetServiceErrors) > 0 {
+		err = mc.GetServiceErrors[0]
+		mc.GetServiceErrors = mc.GetServiceErrors[1:]
+		return serviceModel, err
+	}
+
+	if mc.GetServiceExists && len(mc.GetServiceModelQueue) > 0 {
+		serviceModel = mc.GetServiceModelQueue[0]
+		mc.GetServiceModelQueue = mc.GetServiceModelQueue[1:]
+	} else if mc.GetServiceExists {
 		serviceModel = mc.GetServiceModel
+		if model, exists := mc.GetServiceModelsByName[name]; exists {
+			serviceModel = model
+		}
 	}
 
 	if mc.SimulateErrorOnGetServiceByName {
@@ -0,0 +1,25 @@
+package serviceCreator
+
+import (
+	"time"
+)
+
+// Options holds the settings, usually derived from the commandline, that change how services are created
+type Options struct {
+	DryRun           bool          // Only query CF and report the plan. No CLI commands that modify the foundation are run.
+	Parallel         int           // The maximum number of services provisioned at the same time. 0 or 1 provisions them one after another.
+	ServiceTimeout   time.Duration // How long to wait on a service's last operation. 0 waits forever. Overridden by the service manifest.
+	PollInterval     time.Duration // Initial time between polls of a service's last operation. 0 uses the default. Overridden by the service manifest.
+	AllowPlanChanges bool          // Allow the plan of every existing brokered service to be changed to the one in the service manifest
+	Prune            bool          // Delete plugin managed services of the prune owner that are no longer in the service manifest
+	PruneOwner       string        // Identifies the services manifest whose services are managed, and so may be pruned. Required with Prune.
+	ConfirmPrune     bool          // Confirms that services may be deleted
+	NoStart          bool          // The apps were pushed with --no-start, so they are not restaged after being bound
+	KeepGoing        bool          // Attempt every service, rather than stopping at the first failure
+	Retries          int           // How many times a cf call that fails with a retryable error is retried. Overridden by the service manifest.
+	RetryDelay       time.Duration // Time before the first retry, which doubles after each retry. 0 uses the default.
+	WarnOnConflicts  bool          // Skip, rather than fail, services that conflict with the existing instance of the same name
+	CheckMarketplace bool          // Check that the broker and plan of every brokered service are in the marketplace before creating any service
+	Backend          string        // How services are created, BackendCLI, BackendV3 or BackendFake. Blank uses BackendCLI.
+	FakeStateFile    string        // The file the fake foundation of BackendFake is kept in between runs. Blank keeps it in memory.
+}
@@ -0,0 +1,138 @@
+package serviceCreator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// createServicesInParallel provisions up to options.Parallel services at a time.
+// The cf commands themselves are issued one after another, because the plugin connection
+// does not support concurrent calls. However, the last operations of all in-flight services
+// are polled together, so that the brokers are provisioning them at the same time.
+// A service is only started once all of the services it depends on have succeeded.
+func (c *ServiceCreator) createServicesInParallel(services []serviceManifest.Service) error {
+	results := c.results
+	pending := services
+	inFlight := []*lastOperationPoller{}
+
+	for len(pending) > 0 || len(inFlight) > 0 {
+		// Start as many services, whose dependencies are complete, as we're allowed to
+		stillPending := []serviceManifest.Service{}
+		for _, serviceObject := range pending {
+			name := serviceObject.ServiceName
+			ready, dependencyErr := dependenciesComplete(serviceObject, results)
+
+			if dependencyErr != nil {
+				fmt.Printf("Create Service Error: %s - %+v \n", name, dependencyErr)
+				results.Add(name, PlanSkip, ResultFailed, dependencyErr.Error())
+				continue
+			}
+
+			if !ready || len(inFlight) >= c.options.Parallel {
+				stillPending = append(stillPending, serviceObject)
+				continue
+			}
+
+			var poller *lastOperationPoller
+			started := time.Now()
+			outcome, err := c.provisionService(serviceObject)
+			if err == nil && outcome == provisionInProgress {
+				poller, err = c.newLastOperationPoller(serviceObject, NewProgressReporterWithLoggerOut(prefixedLog(name)))
+			} else if err == nil && outcome == provisionDone {
+				err = c.completeService(serviceObject)
+			}
+
+			if err != nil {
+				fmt.Printf("Create Service Error: %+v \n", err)
+				c.recordResult(name, started, nil, err)
+			} else if outcome == provisionInProgress {
+				poller.started = started
+				inFlight = append(inFlight, poller)
+			} else {
+				c.recordResult(name, started, nil, nil)
+			}
+		}
+		pending = stillPending
+
+		// Poll each of the in-flight services that are due
+		stillInFlight := []*lastOperationPoller{}
+		completedThisRound := false
+		for _, poller := range inFlight {
+			name := poller.name
+			now := time.Now()
+			if now.Before(poller.nextPoll) {
+				stillInFlight = append(stillInFlight, poller)
+				continue
+			}
+
+			done, err := c.checkLastOperation(poller)
+			ignored := false
+			if failure, failed := err.(*lastOperationFailure); failed {
+				// Recreating a service blocks the other services until it has completed
+				ignored, err = c.recoverFromFailure(poller.service, failure)
+				done = err == nil
+			}
+
+			if err == nil && !done && poller.timedOut(now) {
+				err = poller.timeoutError()
+			} else if err == nil && done && !ignored {
+				err = c.completeService(poller.service)
+			}
+
+			if err != nil {
+				fmt.Printf("Create Service Error: %s - %+v \n", name, err)
+				c.recordResult(name, poller.started, poller, err)
+				completedThisRound = true
+			} else if done {
+				c.recordResult(name, poller.started, poller, nil)
+				completedThisRound = true
+			} else {
+				poller.scheduleNextPoll(now)
+				stillInFlight = append(stillInFlight, poller)
+			}
+		}
+		inFlight = stillInFlight
+
+		// Wait until the next in-flight service is due to be polled, unless
+		// a service has just completed and others may now be able to start.
+		if len(inFlight) > 0 && !(completedThisRound && len(pending) > 0) {
+			nextPoll := inFlight[0].nextPoll
+			for _, poller := range inFlight[1:] {
+				if poller.nextPoll.Before(nextPoll) {
+					nextPoll = poller.nextPoll
+				}
+			}
+			time.Sleep(time.Until(nextPoll))
+		}
+	}
+
+	fmt.Printf("\n")
+	results.Print(fmt.Printf)
+
+	return results.Err()
+}
+
+// dependenciesComplete returns true when every dependency of a service has succeeded.
+// An error is returned if any of the dependencies has failed.
+func dependenciesComplete(serviceObject serviceManifest.Service, results *Results) (bool, error) {
+	for _, dependencyName := range serviceObject.DependsOn {
+		result, exists := results.Find(dependencyName)
+		if !exists {
+			return false, nil
+		}
+
+		if result.Status == ResultFailed {
+			return false, fmt.Errorf("not created because the service it depends on, %s, failed", dependencyName)
+		}
+	}
+	return true, nil
+}
+
+// prefixedLog returns a log function that prepends the service name to each output
+func prefixedLog(name string) LogFunc {
+	return func(format string, a ...interface{}) (int, error) {
+		return fmt.Printf(name+": "+format, a...)
+	}
+}
@@ -0,0 +1,76 @@
+package serviceCreator
+
+import (
+	"strings"
+)
+
+// PlanAction describes what will be done, or what was done, to a service instance
+type PlanAction string
+
+// The set of actions that can be taken on a service instance
+const (
+	PlanCreate    PlanAction = "create"
+	PlanUpdate    PlanAction = "update"
+	PlanUnchanged PlanAction = "unchanged"
+	PlanSkip      PlanAction = "skip"
+	PlanDelete    PlanAction = "delete"
+)
+
+// PlanEntry describes the action and the cf command for a single service instance
+type PlanEntry struct {
+	ServiceName string
+	Action      PlanAction
+	Command     []string
+}
+
+// Plan holds the list of actions, in order, that the service creator will take
+type Plan struct {
+	Entries []PlanEntry
+}
+
+// NewPlan creates an empty plan
+func NewPlan() *Plan {
+	return &Plan{Entries: []PlanEntry{}}
+}
+
+// Add appends an action for a service to the plan
+func (p *Plan) Add(serviceName string, action PlanAction, command []string) {
+	p.Entries = append(p.Entries, PlanEntry{
+		ServiceName: serviceName,
+		Action:      action,
+		Command:     command,
+	})
+}
+
+// Print writes out the plan, one line per service, to the given log function
+func (p *Plan) Print(log LogFunc) {
+	nameWidth, actionWidth := len("SERVICE"), len("ACTION")+2
+	for _, entry := range p.Entries {
+		if len(entry.ServiceName) > nameWidth {
+			nameWidth = len(entry.ServiceName)
+		}
+		if len(entry.Action) > actionWidth {
+			actionWidth = len(entry.Action)
+		}
+	}
+
+	log("%-*s %-*s %s\n", actionWidth, "ACTION", nameWidth, "SERVICE", "COMMAND")
+	for _, entry := range p.Entries {
+		command := "-"
+		if len(entry.Command) > 0 {
+			command = "cf " + strings.Join(entry.Command, " ")
+		}
+		log("%-*s %-*s %s\n", actionWidth, entry.Action, nameWidth, entry.ServiceName, command)
+	}
+}
+
+// Action returns the most recent action planned for a service. If the service is
+// not in the plan, it is assumed to have been skipped.
+func (p *Plan) Action(serviceName string) PlanAction {
+	for idx := len(p.Entries) - 1; idx >= 0; idx-- {
+		if p.Entries[idx].ServiceName == serviceName {
+			return p.Entries[idx].Action
+		}
+	}
+	return PlanSkip
+}
@@ -0,0 +1,102 @@
+package serviceCreator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// defaultPollInterval is the initial time between polls of a last operation, if none was specified
+const defaultPollInterval = 2 * time.Second
+
+// maxPollInterval is the longest the exponential backoff will wait between polls,
+// unless the specified poll interval is already longer than this.
+const maxPollInterval = 30 * time.Second
+
+// lastOperationPoller tracks when the last operation of a service should next be polled and when to give up on it
+type lastOperationPoller struct {
+	name             string
+	service          serviceManifest.Service
+	timeout          time.Duration // 0 waits forever
+	deadline         time.Time
+	interval         time.Duration
+	maxInterval      time.Duration
+	nextPoll         time.Time
+	started          time.Time
+	lastState        string
+	lastDescription  string
+	progressReporter *ProgressReporter
+}
+
+// newLastOperationPoller creates a poller for a service. The timeout and poll interval in the
+// service manifest take precedence over those in the options.
+func (c *ServiceCreator) newLastOperationPoller(serviceObject serviceManifest.Service, progressReporter *ProgressReporter) (*lastOperationPoller, error) {
+	timeout, err := serviceObject.TimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		timeout = c.options.ServiceTimeout
+	}
+
+	interval, err := serviceObject.PollIntervalDuration()
+	if err != nil {
+		return nil, err
+	}
+	if interval == 0 {
+		interval = c.options.PollInterval
+	}
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	maxInterval := maxPollInterval
+	if interval > maxInterval {
+		maxInterval = interval
+	}
+
+	now := time.Now()
+	poller := &lastOperationPoller{
+		name:             serviceObject.ServiceName,
+		service:          serviceObject,
+		timeout:          timeout,
+		interval:         interval,
+		maxInterval:      maxInterval,
+		nextPoll:         now,
+		started:          now,
+		progressReporter: progressReporter,
+	}
+	if timeout > 0 {
+		poller.deadline = now.Add(timeout)
+	}
+	return poller, nil
+}
+
+// timedOut returns true once the deadline of the poller has been reached
+func (p *lastOperationPoller) timedOut(now time.Time) bool {
+	return p.timeout > 0 && !now.Before(p.deadline)
+}
+
+// scheduleNextPoll sets the time of the next poll and doubles the interval for the one after that.
+// The next poll is never scheduled beyond the deadline, so that the timeout is checked on time.
+func (p *lastOperationPoller) scheduleNextPoll(now time.Time) {
+	p.nextPoll = now.Add(p.interval)
+	if p.timeout > 0 && p.nextPoll.After(p.deadline) {
+		p.nextPoll = p.deadline
+	}
+
+	p.interval *= 2
+	if p.interval > p.maxInterval {
+		p.interval = p.maxInterval
+	}
+}
+
+// timeoutError describes the service that timed out along with what it was last doing
+func (p *lastOperationPoller) timeoutError() error {
+	description := p.lastDescription
+	if description == "" {
+		description = "none reported"
+	}
+	return fmt.Errorf("timed out after %s waiting for service %s to complete. Last reported operation: %s", p.timeout, p.name, description)
+}
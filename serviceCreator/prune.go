@@ -0,0 +1,246 @@
+package serviceCreator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// ManagedTag, followed by a colon and the prune owner, is added to the tags of services created or updated while
+// pruning is enabled. Services carrying the tag of the same owner, that are no longer in the service manifest, are
+// deleted by --prune. Services of other owners, e.g., another services manifest in the same space, are left alone.
+const ManagedTag = "create-service-push-managed"
+
+// managedTag returns the tag that marks the services managed by the prune owner
+func managedTag(owner string) string {
+	return ManagedTag + ":" + owner
+}
+
+// pruneCandidate is a service instance that will be deleted along with the apps bound to it
+type pruneCandidate struct {
+	service      serviceManifest.Service
+	appNames     []string
+	userProvided bool
+	reason       string
+}
+
+// pruneServices deletes the services marked absent in the manifest and, with the prune option,
+// any plugin managed services that are no longer in the manifest. Deleting requires confirmation.
+func (c *ServiceCreator) pruneServices() error {
+	hasAbsentServices := false
+	for _, serviceObject := range c.manifest.Services {
+		if serviceObject.State == "absent" {
+			hasAbsentServices = true
+		}
+	}
+	if !hasAbsentServices && !c.options.Prune {
+		return nil
+	}
+
+	candidates, err := c.findPruneCandidates()
+	if err != nil || len(candidates) == 0 {
+		return err
+	}
+
+	if !c.options.ConfirmPrune && !c.options.DryRun {
+		names := []string{}
+		for _, candidate := range candidates {
+			names = append(names, fmt.Sprintf("%s (%s)", candidate.service.ServiceName, candidate.reason))
+		}
+		return fmt.Errorf("The following services would be deleted: %s. Re-run with --confirm-prune to delete them", strings.Join(names, ", "))
+	}
+
+	for _, candidate := range candidates {
+		started := time.Now()
+		err = c.deleteService(candidate)
+		c.recordResult(candidate.service.ServiceName, started, nil, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findPruneCandidates returns the existing service instances that should be deleted
+func (c *ServiceCreator) findPruneCandidates() ([]pruneCandidate, error) {
+	existingServices, err := c.inventory.All()
+	if err != nil {
+		return nil, err
+	}
+
+	manifestServices := map[string]serviceManifest.Service{}
+	for _, serviceObject := range c.manifest.Services {
+		manifestServices[serviceObject.ServiceName] = serviceObject
+	}
+
+	candidates := []pruneCandidate{}
+	for _, existing := range existingServices {
+		serviceObject, inManifest := manifestServices[existing.Name]
+
+		if inManifest {
+			if serviceObject.State == "absent" {
+				candidates = append(candidates, pruneCandidate{serviceObject, existing.ApplicationNames, existing.IsUserProvided, "marked absent"})
+			}
+			continue
+		}
+
+		if !c.options.Prune {
+			continue
+		}
+
+		managed, err := c.isManaged(existing)
+		if err != nil {
+			return nil, err
+		}
+		if managed {
+			candidates = append(candidates, pruneCandidate{
+				serviceManifest.Service{ServiceName: existing.Name},
+				existing.ApplicationNames,
+				existing.IsUserProvided,
+				"no longer in the services manifest"})
+		}
+	}
+	return candidates, nil
+}
+
+// isManaged returns true if the service instance carries the managed tag of the prune owner
+func (c *ServiceCreator) isManaged(service plugin_models.GetServices_Model) (bool, error) {
+	var tags []string
+	err := c.withRetries(service.Name, "reading its tags", func() error {
+		var err error
+		tags, err = c.backend.GetServiceTags(service)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, tag := range tags {
+		if tag == managedTag(c.options.PruneOwner) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deleteService unbinds a service from its apps, deletes its keys and shares, deletes it and waits for the
+// deletion to complete. The Cloud Controller refuses to delete a service instance that still has any of them.
+func (c *ServiceCreator) deleteService(candidate pruneCandidate) error {
+	name := candidate.service.ServiceName
+	fmt.Printf("%s - %s...will now be deleted.\n", name, candidate.reason)
+
+	for _, appName := range candidate.appNames {
+		appName := appName
+		err := c.execute(name, PlanDelete, unbindServiceCommand(appName, name), func() error { return c.backend.UnbindService(appName, name) })
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only brokered services have keys and shares
+	if !candidate.userProvided {
+		if err := c.deleteKeysAndShares(name); err != nil {
+			return err
+		}
+	}
+
+	err := c.execute(name, PlanDelete, deleteServiceCommand(name), func() error { return c.backend.DeleteService(name) })
+	if err != nil || c.options.DryRun {
+		return err
+	}
+
+	return c.waitForDeletion(candidate.service)
+}
+
+// deleteKeysAndShares deletes every key of a service and unshares it from every space it is shared to
+func (c *ServiceCreator) deleteKeysAndShares(name string) error {
+	existingKeys, err := c.getServiceKeyNames(name)
+	if err != nil {
+		return err
+	}
+	existingShares, err := c.getSharedTo(name)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(existingKeys) {
+		key := key
+		err = c.execute(name, PlanDelete, deleteServiceKeyCommand(name, key), func() error { return c.backend.DeleteServiceKey(name, key) })
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, target := range sortedKeys(existingShares) {
+		org, space := splitTarget(target)
+		err = c.execute(name, PlanDelete, unshareServiceCommand(name, org, space), func() error { return c.backend.UnshareService(name, org, space) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForDeletion polls until the service no longer exists, or its delete operation failed or timed out.
+func (c *ServiceCreator) waitForDeletion(serviceObject serviceManifest.Service) error {
+	// The services are listed directly while waiting, so the inventory, which may still hold the service, is loaded again
+	defer c.inventory.Invalidate()
+
+	poller, err := c.newLastOperationPoller(serviceObject, c.progressReporter)
+	if err != nil {
+		return err
+	}
+
+	for {
+		existingServices, err := c.getServices(serviceObject.ServiceName)
+		if err != nil {
+			return err
+		}
+
+		exists := false
+		for _, existing := range existingServices {
+			if existing.Name == poller.name {
+				exists = true
+			}
+		}
+		if !exists {
+			return nil
+		}
+
+		service, err := c.getService(poller.name)
+		if err != nil {
+			return err
+		}
+
+		poller.lastDescription = service.LastOperation.Description
+		poller.progressReporter.Step(service.LastOperation.Description)
+
+		if service.LastOperation.State == "failed" {
+			return fmt.Errorf(
+				"error deleting %s: %s [status: %s]",
+				poller.name,
+				service.LastOperation.Description,
+				service.LastOperation.State,
+			)
+		}
+
+		now := time.Now()
+		if poller.timedOut(now) {
+			return poller.timeoutError()
+		}
+
+		poller.scheduleNextPoll(now)
+		time.Sleep(poller.nextPoll.Sub(now))
+	}
+}
+
+// withManagedTag adds the managed tag of the prune owner to a comma separated list of tags
+func withManagedTag(tags, owner string) string {
+	if tags == "" {
+		return managedTag(owner)
+	}
+	return tags + ", " + managedTag(owner)
+}
@@ -0,0 +1,90 @@
+package serviceCreator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResultStatus describes the final outcome of provisioning a service
+type ResultStatus string
+
+// The set of outcomes for a service
+const (
+	ResultSucceeded ResultStatus = "succeeded"
+	ResultFailed    ResultStatus = "failed"
+)
+
+// Result holds the outcome of provisioning a single service
+type Result struct {
+	ServiceName              string
+	Action                   PlanAction
+	Status                   ResultStatus
+	Message                  string
+	Duration                 time.Duration // How long the service took, from its cf command to its completion
+	LastOperationState       string        // The final state of the last operation. Blank if it wasn't polled
+	LastOperationDescription string
+}
+
+// Results holds the outcome of each service, in the order they completed
+type Results struct {
+	Entries []Result
+}
+
+// NewResults creates an empty set of results
+func NewResults() *Results {
+	return &Results{Entries: []Result{}}
+}
+
+// Add appends the outcome of a service to the results
+func (r *Results) Add(serviceName string, action PlanAction, status ResultStatus, message string) {
+	r.Entries = append(r.Entries, Result{
+		ServiceName: serviceName,
+		Action:      action,
+		Status:      status,
+		Message:     message,
+	})
+}
+
+// Find returns the result of a service, if it has completed
+func (r *Results) Find(serviceName string) (Result, bool) {
+	for _, result := range r.Entries {
+		if result.ServiceName == serviceName {
+			return result, true
+		}
+	}
+	return Result{}, false
+}
+
+// Err returns a single error naming every service that failed, or nil if all succeeded
+func (r *Results) Err() error {
+	failures := []string{}
+	for _, result := range r.Entries {
+		if result.Status == ResultFailed {
+			failures = append(failures, fmt.Sprintf("%s: %s", result.ServiceName, result.Message))
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d service(s) failed:\n%s", len(failures), strings.Join(failures, "\n"))
+}
+
+// Print writes out a table of results, one line per service, to the given log function
+func (r *Results) Print(log LogFunc) {
+	nameWidth, actionWidth := len("SERVICE"), len("ACTION")+2
+	for _, result := range r.Entries {
+		if len(result.ServiceName) > nameWidth {
+			nameWidth = len(result.ServiceName)
+		}
+		if len(result.Action) > actionWidth {
+			actionWidth = len(result.Action)
+		}
+	}
+
+	log("%-*s %-*s %-10s %s\n", nameWidth, "SERVICE", actionWidth, "ACTION", "STATUS", "MESSAGE")
+	for _, result := range r.Entries {
+		log("%-*s %-*s %-10s %s\n", nameWidth, result.ServiceName, actionWidth, result.Action, result.Status, result.Message)
+	}
+}
@@ -0,0 +1,151 @@
+package serviceCreator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// defaultRetryDelay is the time before the first retry of a failed cf call, if none was specified
+const defaultRetryDelay = 2 * time.Second
+
+// maxRetryDelay is the longest the backoff will wait between retries
+const maxRetryDelay = 30 * time.Second
+
+// retryableStatuses are the Cloud Controller responses of the v3 backend that are expected to go away on their own
+var retryableStatuses = map[int]bool{
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// retryableTitles are the Cloud Controller errors, of the v3 backend or of cf curl, that are expected to go away on
+// their own. The access token is refreshed by the cf CLI before every request.
+var retryableTitles = map[string]bool{
+	"CF-AsyncServiceInstanceOperationInProgress": true,
+	"CF-InvalidAuthToken":                        true,
+}
+
+// retryableMessages are the messages of the cf CLI, for reads through the plugin models, that are expected to go
+// away on their own. They are matched from the start of the message, so that a service name, GUID or path in a
+// message can't make a permanent error look retryable.
+var retryableMessages = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^invalid auth token`),
+	regexp.MustCompile(`(?i)^unable to refresh token`),
+	regexp.MustCompile(`(?i)^an operation for service instance .+ is in progress`),
+}
+
+// isRetryable returns true if the error is one that is expected to go away by itself. Any other error, e.g., a plan
+// that doesn't exist, is permanent. The cf CLI reports every failed command to plugins with the same error, so a
+// failed cf CLI command is only retried when its service is found to have another operation in progress.
+func isRetryable(err error) bool {
+	var inProgressErr *operationInProgressError
+	if errors.As(err, &inProgressErr) {
+		return true
+	}
+
+	var ccErr *v3Error
+	if errors.As(err, &ccErr) {
+		if retryableStatuses[ccErr.statusCode] {
+			return true
+		}
+		for _, title := range ccErr.titles {
+			if retryableTitles[title] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var curlErr *curlError
+	if errors.As(err, &curlErr) {
+		return retryableTitles[curlErr.title]
+	}
+
+	// Failures to reach the Cloud Controller at all
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	for _, message := range retryableMessages {
+		if message.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// retriesFor returns how many times a failed cf call, made for a service, is retried.
+// The retries of the service in the manifest take precedence over those in the options.
+func (c *ServiceCreator) retriesFor(name string) int {
+	// Service keys and shares are named service/key and service/org/space
+	serviceName := strings.SplitN(name, "/", 2)[0]
+	if c.manifest != nil {
+		for _, serviceObject := range c.manifest.Services {
+			if serviceObject.ServiceName == serviceName && serviceObject.Retries > 0 {
+				return serviceObject.Retries
+			}
+		}
+	}
+	return c.options.Retries
+}
+
+// withRetries makes a cf call until it succeeds, fails with an error that isn't retryable or runs out of retries.
+// The delay between retries doubles after each one.
+func (c *ServiceCreator) withRetries(name, description string, call func() error) error {
+	retries := c.retriesFor(name)
+	delay := c.options.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt > retries || !isRetryable(err) {
+			return err
+		}
+
+		fmt.Printf("%s - %s failed with a retryable error. Retry %d of %d in %s: %s\n", name, description, attempt, retries, delay, err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// getServices lists the services in the targeted space, retrying on behalf of the named service
+func (c *ServiceCreator) getServices(name string) ([]plugin_models.GetServices_Model, error) {
+	var services []plugin_models.GetServices_Model
+	err := c.withRetries(name, "cf services", func() error {
+		var err error
+		services, err = c.backend.ListServices()
+		return err
+	})
+	return services, err
+}
+
+// getService gets the named service, retrying if needed
+func (c *ServiceCreator) getService(name string) (plugin_models.GetService_Model, error) {
+	var service plugin_models.GetService_Model
+	err := c.withRetries(name, "cf service", func() error {
+		var err error
+		service, err = c.backend.GetService(name)
+		return err
+	})
+	return service, err
+}
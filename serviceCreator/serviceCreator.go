@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/cli/plugin"
 	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
@@ -12,7 +13,10 @@ import (
 
 // CreatorInterface shows the set of methods that describes the serviceCreator
 type CreatorInterface interface {
-	CreateServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection) error
+	CreateServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options Options) error
+	BindServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options Options) error
+	CheckMarketplace(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options Options) error
+	Results() *Results
 }
 
 // ServiceCreator describes the components required for service creation
@@ -20,6 +24,11 @@ type ServiceCreator struct {
 	manifest         *serviceManifest.ServiceManifest
 	cf               plugin.CliConnection
 	progressReporter *ProgressReporter
+	options          Options
+	plan             *Plan
+	results          *Results
+	inventory        *Inventory
+	backend          ServiceBackend
 }
 
 // NewServiceCreator creates a service creator with the default progress reporter
@@ -27,120 +36,355 @@ func NewServiceCreator() *ServiceCreator {
 	return &ServiceCreator{progressReporter: NewProgressReporter()}
 }
 
+// NewServiceCreatorWithBackend creates a service creator that carries out every operation with backend,
+// rather than the backend in the options
+func NewServiceCreatorWithBackend(backend ServiceBackend) *ServiceCreator {
+	return &ServiceCreator{progressReporter: NewProgressReporter(), backend: backend}
+}
+
 // CreateServices creates the services specified by manifest via a cliConnection
-func (c *ServiceCreator) CreateServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection) error {
+func (c *ServiceCreator) CreateServices(manifest *serviceManifest.ServiceManifest, cf plugin.CliConnection, options Options) error {
 
 	createServicesobject := &ServiceCreator{
 		manifest:         manifest,
 		cf:               cf,
 		progressReporter: NewProgressReporter(),
+		options:          options,
+		plan:             NewPlan(),
+		results:          NewResults(),
+		backend:          c.backend,
+	}
+	createServicesobject.inventory = NewInventory(createServicesobject.getServices)
+	if err := createServicesobject.connectBackend(); err != nil {
+		return err
 	}
 
-	return createServicesobject.createServices()
+	err := createServicesobject.createServices()
+	c.results = createServicesobject.results
+	return err
 }
 
-func (c *ServiceCreator) createServices() error {
+// connectBackend connects to the backend in the options, unless the service creator was given a backend.
+// Services are created with cf CLI commands, unless another backend is chosen.
+func (c *ServiceCreator) connectBackend() error {
+	if c.backend != nil {
+		return nil
+	}
+
 	var err error
+	switch c.options.Backend {
+	case "", BackendCLI:
+		c.backend = newCLIBackend(c.cf)
+	case BackendV3:
+		c.backend, err = newV3Backend(c.cf)
+	case BackendFake:
+		c.backend, err = LoadFakeBackend(c.options.FakeStateFile)
+	default:
+		err = fmt.Errorf("backend %s is not supported. Use %s, %s or %s", c.options.Backend, BackendCLI, BackendV3, BackendFake)
+	}
+	return err
+}
+
+// Results returns the outcome of each service from the last call to CreateServices
+func (c *ServiceCreator) Results() *Results {
+	if c.results == nil {
+		return NewResults()
+	}
+	return c.results
+}
+
+func (c *ServiceCreator) createServices() error {
+	// Services are created in an order where dependencies come first
+	sortedServices, err := c.manifest.SortByDependencies()
+	if err != nil {
+		return err
+	}
+
+	// Without an owner, pruning would delete the managed services of every services manifest in the space
+	if c.options.Prune && c.options.PruneOwner == "" {
+		return fmt.Errorf("pruning requires a prune owner, naming the services manifest whose services may be pruned")
+	}
+
+	// A broker or plan that isn't in the marketplace is caught before any service is created
+	if c.options.CheckMarketplace {
+		if err = c.checkMarketplace(); err != nil {
+			return err
+		}
+	}
+
+	// Services marked absent are deleted, rather than created, once all other services are done
+	services := []serviceManifest.Service{}
+	for _, serviceObject := range sortedServices {
+		if serviceObject.State != "absent" {
+			services = append(services, serviceObject)
+		}
+	}
+
+	if c.options.Parallel > 1 {
+		err = c.createServicesInParallel(services)
+	} else {
+		for _, serviceObject := range services {
+			// With keep-going, a service whose dependency failed is not attempted
+			if c.options.KeepGoing {
+				if _, dependencyErr := dependenciesComplete(serviceObject, c.results); dependencyErr != nil {
+					fmt.Printf("Create Service Error: %s - %+v \n", serviceObject.ServiceName, dependencyErr)
+					c.results.Add(serviceObject.ServiceName, PlanSkip, ResultFailed, dependencyErr.Error())
+					continue
+				}
+			}
+
+			var outcome provisionOutcome
+			var poller *lastOperationPoller
+			started := time.Now()
+			outcome, err = c.provisionService(serviceObject)
+			if err == nil && outcome == provisionInProgress {
+				poller, err = c.newLastOperationPoller(serviceObject, c.progressReporter)
+				if err == nil {
+					err = c.waitForService(poller)
+				}
+			}
+			var ignored bool
+			if failure, failed := err.(*lastOperationFailure); failed {
+				ignored, err = c.recoverFromFailure(serviceObject, failure)
+			}
+			if err == nil && !ignored && outcome != provisionSkipped {
+				err = c.completeService(serviceObject)
+			}
+			c.recordResult(serviceObject.ServiceName, started, poller, err)
+
+			// If we encounter any errors, quit immediately, so errors are caught early, unless asked to keep going.
+			if err != nil {
+				fmt.Printf("Create Service Error: %+v \n", err)
+				if !c.options.KeepGoing {
+					break
+				}
+			}
+		}
+
+		if c.options.KeepGoing {
+			fmt.Printf("\n")
+			c.results.Print(fmt.Printf)
+			err = c.results.Err()
+		}
+	}
+
+	if err == nil {
+		err = c.pruneServices()
+	}
+
+	if err == nil && c.options.DryRun {
+		fmt.Printf("\nDry run - no changes were made. The following would be performed:\n")
+		c.plan.Print(fmt.Printf)
+	}
+
+	return err
+}
+
+// provisionOutcome describes what is left to do for a service once it has been provisioned
+type provisionOutcome int
+
+const (
+	provisionDone       provisionOutcome = iota // The service is ready for its keys and shares
+	provisionInProgress                         // The service has an operation in progress that should be waited on
+	provisionSkipped                            // The service conflicts with its manifest entry, or its failure is ignored, so nothing more is done to it
+)
+
+// provisionService issues the cf command that creates or updates a service, and returns what is left to do for it
+func (c *ServiceCreator) provisionService(serviceObject serviceManifest.Service) (provisionOutcome, error) {
 	// Detect the type of service and then go and create them.
 	// credentials: User provided credentials service
 	// drain: User provided log drain service
 	// route: User provided route service
 	// brokered: Brokered service.  The type field can be blank to specify this as well.
-	for _, serviceObject := range c.manifest.Services {
-		if serviceObject.Type == "credentials" {
-			err = c.createUserProvidedCredentialsService(
-				serviceObject.ServiceName,
-				serviceObject.Credentials,
-				serviceObject.Tags,
-				serviceObject.UpdateService)
-		} else if serviceObject.Type == "drain" {
-			err = c.createUserProvidedLogDrainService(
-				serviceObject.ServiceName,
-				serviceObject.URL,
-				serviceObject.Tags,
-				serviceObject.UpdateService)
-		} else if serviceObject.Type == "route" {
-			err = c.createUserProvidedRouteService(
-				serviceObject.ServiceName,
-				serviceObject.URL,
-				serviceObject.Tags,
-				serviceObject.UpdateService)
-		} else {
-			if serviceObject.Type == "brokered" || serviceObject.Type == "" {
-				err = c.createService(serviceObject.ServiceName,
-					serviceObject.Broker,
-					serviceObject.PlanName,
-					serviceObject.JSONParameters,
-					serviceObject.Tags,
-					serviceObject.UpdateService)
-			} else {
-				err = fmt.Errorf("Service Type: %s unsupported", serviceObject.Type)
+	if conflicting, err := c.checkConflicts(serviceObject); err != nil {
+		return provisionDone, err
+	} else if conflicting {
+		return provisionSkipped, nil
+	}
+
+	isBrokered := serviceObject.Type == "brokered" || serviceObject.Type == ""
+	if isBrokered {
+		// An existing service whose last operation failed is not healthy, so it is handled by its onFailure policy,
+		// even if it carries the fingerprint of its manifest entry. An ignored failure leaves the service as it is.
+		failure, err := c.checkExistingService(serviceObject)
+		if err != nil {
+			return provisionDone, err
+		}
+		if failure != nil {
+			ignored, err := c.handleFailure(serviceObject, failure)
+			if err != nil {
+				return provisionDone, err
+			} else if ignored {
+				return provisionSkipped, nil
 			}
 		}
+	}
 
-		// If we encounter any errors, quit immediately, so errors are caught early.
-		if err != nil {
-			fmt.Printf("Create Service Error: %+v \n", err)
-			break
+	if serviceObject.UpdateService && c.isUnchanged(serviceObject) {
+		c.unchanged(serviceObject.ServiceName)
+		return provisionDone, nil
+	}
+
+	if serviceObject.Type == "credentials" {
+		return provisionDone, c.createUserProvidedCredentialsService(
+			serviceObject.ServiceName,
+			serviceObject.Credentials,
+			serviceObject.Tags,
+			serviceObject.UpdateService)
+	} else if serviceObject.Type == "drain" {
+		return provisionDone, c.createUserProvidedLogDrainService(
+			serviceObject.ServiceName,
+			serviceObject.URL,
+			serviceObject.Tags,
+			serviceObject.UpdateService)
+	} else if serviceObject.Type == "route" {
+		return provisionDone, c.createUserProvidedRouteService(
+			serviceObject.ServiceName,
+			serviceObject.URL,
+			serviceObject.Tags,
+			serviceObject.UpdateService)
+	} else if isBrokered {
+		inProgress, err := c.createService(serviceObject.ServiceName,
+			serviceObject.Broker,
+			serviceObject.PlanName,
+			serviceObject.JSONParameters,
+			serviceObject.Tags,
+			serviceObject.UpdateService,
+			serviceObject.AllowPlanChange || c.options.AllowPlanChanges)
+		if inProgress {
+			return provisionInProgress, err
 		}
+		return provisionDone, err
 	}
 
-	return err
+	return provisionDone, fmt.Errorf("Service Type: %s unsupported", serviceObject.Type)
 }
 
-func (c *ServiceCreator) run(args ...string) error {
-	fmt.Printf("Now Running CLI Command: %s\n", strings.Join(args, " "))
-	_, err := c.cf.CliCommand(args...)
-	return err
+// completeService performs the steps that require a service to exist and have succeeded
+func (c *ServiceCreator) completeService(serviceObject serviceManifest.Service) error {
+	if err := c.recordMetadata(serviceObject); err != nil {
+		return err
+	}
+	c.recordFingerprint(serviceObject)
+	if err := c.createServiceKeys(serviceObject); err != nil {
+		return err
+	}
+	return c.shareService(serviceObject)
 }
 
-func (c *ServiceCreator) createUserProvidedCredentialsService(name string, credentials map[string]string, tags string, updateService bool) error {
+// recordResult adds the outcome of a service to the results, along with how long it took and,
+// if it was polled, the final state of its last operation
+func (c *ServiceCreator) recordResult(name string, started time.Time, poller *lastOperationPoller, err error) {
+	result := Result{
+		ServiceName: name,
+		Action:      c.plan.Action(name),
+		Status:      ResultSucceeded,
+		Duration:    time.Since(started),
+	}
+	if err != nil {
+		result.Status = ResultFailed
+		result.Message = err.Error()
+	}
+	if poller != nil {
+		result.LastOperationState = poller.lastState
+		result.LastOperationDescription = poller.lastDescription
+	}
+	c.results.Entries = append(c.results.Entries, result)
+}
+
+// skip records that the service needs no action
+func (c *ServiceCreator) skip(name string) {
+	fmt.Print("already exists...skipping creation\n")
+	c.plan.Add(name, PlanSkip, nil)
+}
+
+// execute records the action for the service in the plan, along with the equivalent cf command, and carries out the
+// operation with the backend. On a dry run, the command is only reported and the operation is never carried out.
+func (c *ServiceCreator) execute(name string, action PlanAction, args []string, operation func() error) error {
+	c.plan.Add(name, action, args)
+	if c.options.DryRun {
+		fmt.Printf("Would run CLI Command: %s\n", strings.Join(args, " "))
+		return nil
+	}
+	// Any operation may change the services in the space, even one that failed
+	defer c.inventory.Invalidate()
+	return c.withRetries(name, "cf "+args[0], operation)
+}
+
+// createOrUpdate creates, or updates, a service with the backend
+func (c *ServiceCreator) createOrUpdate(request ServiceRequest, update bool) error {
+	if update {
+		return c.execute(request.Name, PlanUpdate, request.cfCommand(true), func() error {
+			return c.backend.UpdateService(request)
+		})
+	}
+	return c.execute(request.Name, PlanCreate, request.cfCommand(false), func() error {
+		return c.backend.CreateService(request)
+	})
+}
+
+// tags returns a comma separated list of tags. With pruning enabled, the managed tag of the prune owner is added,
+// so that the service can be pruned once it is removed from the manifest.
+func (c *ServiceCreator) tags(tags string) string {
+	if c.options.Prune {
+		return withManagedTag(tags, c.options.PruneOwner)
+	}
+	return tags
+}
+
+// tagArgs returns the -t argument for a comma separated list of tags, including the plugin managed tag when pruning
+func (c *ServiceCreator) tagArgs(tags string) []string {
+	if tags = c.tags(tags); tags == "" {
+		return []string{}
+	}
+	return []string{"-t", tags}
+}
+
+func (c *ServiceCreator) createUserProvidedCredentialsService(name string, credentials interface{}, tags string, updateService bool) error {
 	fmt.Printf("%s - ", name)
 	var shouldUpdateService bool
-	s, err := c.cf.GetServices()
+	serviceExists, err := c.inventory.Exists(name)
 	if err != nil {
 		return err
 	}
 
-	for _, svc := range s {
-		if svc.Name == name {
-			if !updateService {
-				fmt.Print("already exists...skipping creation\n")
-				return nil
-			}
-			shouldUpdateService = true
+	if serviceExists {
+		if !updateService {
+			c.skip(name)
+			return nil
 		}
+		shouldUpdateService = true
 	}
 
-	credentialsJSON, _ := json.Marshal(credentials)
+	credentialsJSON, err := json.Marshal(credentials)
+	if err != nil {
+		return fmt.Errorf("the credentials of service %s can not be converted to JSON: %s", name, err)
+	}
 
 	if shouldUpdateService {
 		fmt.Print("user provided credential service will now be updated.\n")
-		err = c.run("uups", name, "-p", string(credentialsJSON))
 	} else {
 		fmt.Print("will now be created as a user provided credential service.\n")
-		err = c.run("cups", name, "-p", string(credentialsJSON))
 	}
 
-	return err
+	request := ServiceRequest{Name: name, Type: "credentials", Credentials: string(credentialsJSON), Tags: c.tags(tags)}
+	return c.createOrUpdate(request, shouldUpdateService)
 }
 
 func (c *ServiceCreator) createUserProvidedRouteService(name, urlString, tags string, updateService bool) error {
 	fmt.Printf("%s - ", name)
 	var shouldUpdateService bool
-	s, err := c.cf.GetServices()
+	serviceExists, err := c.inventory.Exists(name)
 	if err != nil {
 		return err
 	}
 
-	for _, svc := range s {
-		if svc.Name == name {
-			if !updateService {
-				fmt.Print("already exists...skipping creation\n")
-				return nil
-			}
-			shouldUpdateService = true
+	if serviceExists {
+		if !updateService {
+			c.skip(name)
+			return nil
 		}
+		shouldUpdateService = true
 	}
 
 	// Check to ensure that the url begins with HTTPS because that is the only scheme supported for now.
@@ -156,108 +400,175 @@ func (c *ServiceCreator) createUserProvidedRouteService(name, urlString, tags st
 
 	if shouldUpdateService {
 		fmt.Print("user provided route service will now be updated.\n")
-		err = c.run("uups", name, "-r", urlString)
 	} else {
 		fmt.Print("will now be created as a user provided route service.\n")
-		err = c.run("cups", name, "-r", urlString)
 	}
 
-	return err
+	request := ServiceRequest{Name: name, Type: "route", URL: urlString, Tags: c.tags(tags)}
+	return c.createOrUpdate(request, shouldUpdateService)
 }
 
 func (c *ServiceCreator) createUserProvidedLogDrainService(name, urlString, tags string, updateService bool) error {
 	fmt.Printf("%s - ", name)
 	var shouldUpdateService bool
-	s, err := c.cf.GetServices()
+	serviceExists, err := c.inventory.Exists(name)
 	if err != nil {
 		return err
 	}
 
-	for _, svc := range s {
-		if svc.Name == name {
-			if !updateService {
-				fmt.Print("already exists...skipping creation\n")
-				return nil
-			}
-			shouldUpdateService = true
+	if serviceExists {
+		if !updateService {
+			c.skip(name)
+			return nil
 		}
+		shouldUpdateService = true
 	}
 
 	if shouldUpdateService {
 		fmt.Print("user provided log drain service will now be updated.\n")
-		err = c.run("uups", name, "-l", urlString)
 	} else {
 		fmt.Print("will now be created as a user provided log drain service.\n")
-		err = c.run("cups", name, "-l", urlString)
 	}
 
-	return err
+	request := ServiceRequest{Name: name, Type: "drain", URL: urlString, Tags: c.tags(tags)}
+	return c.createOrUpdate(request, shouldUpdateService)
 }
 
-func (c *ServiceCreator) createService(name, broker, plan, JSONParam, tags string, updateService bool) error {
+func (c *ServiceCreator) createService(name, broker, plan, JSONParam, tags string, updateService, allowPlanChange bool) (bool, error) {
 	fmt.Printf("%s - ", name)
-	var shouldUpdateService bool
-	s, err := c.cf.GetServices()
+	serviceExists, err := c.inventory.Exists(name)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	for _, svc := range s {
-		if svc.Name == name {
-			if !updateService {
-				fmt.Print("already exists...skipping creation\n")
-				return nil
-			}
-			shouldUpdateService = true
-		}
+	// On a dry run, a service that is being recreated has only been deleted in the plan
+	if c.plan.Action(name) == PlanDelete {
+		serviceExists = false
 	}
 
-	// Collect the parameters
-	optionalArgs := []string{}
-	if tags != "" {
-		optionalArgs = append(optionalArgs, "-t")
-		optionalArgs = append(optionalArgs, fmt.Sprintf("\"%s\"", tags))
+	var shouldChangePlan bool
+	if serviceExists {
+		shouldChangePlan, err = c.checkPlanDrift(name, plan, allowPlanChange)
+		if err != nil {
+			return false, err
+		}
+
+		if !updateService && !shouldChangePlan {
+			c.skip(name)
+			return false, nil
+		}
 	}
 
 	if JSONParam != "" {
-		optionalArgs = append(optionalArgs, "-c")
-		optionalArgs = append(optionalArgs, fmt.Sprintf("%s", JSONParam))
+		var parameters interface{}
+		if err = json.Unmarshal([]byte(JSONParam), &parameters); err != nil {
+			return false, fmt.Errorf("the parameters of service %s are not valid JSON: %s", name, err)
+		}
 	}
 
-	if shouldUpdateService {
-		fmt.Printf("broker service will now be updated.\n")
-		err = c.run(append([]string{"update-service", name}, optionalArgs...)...)
+	request := ServiceRequest{Name: name, Broker: broker, Plan: plan, Parameters: JSONParam, Tags: c.tags(tags)}
+	if serviceExists {
+		if !shouldChangePlan {
+			request.Plan = ""
+		}
+
+		if updateService {
+			fmt.Printf("broker service will now be updated.\n")
+		} else {
+			fmt.Printf("broker service plan will now be updated.\n")
+			request.Parameters, request.Tags = "", ""
+		}
 	} else {
 		fmt.Printf("will now be created as a brokered service.\n")
-		err = c.run(append([]string{"create-service", broker, plan, name}, optionalArgs...)...)
 	}
+	err = c.createOrUpdate(request, serviceExists)
 
+	if err != nil || c.options.DryRun {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// checkPlanDrift compares the plan of an existing service against the plan in the manifest.
+// It returns true if they differ and the plan is allowed to be changed. Otherwise, the drift is only reported.
+func (c *ServiceCreator) checkPlanDrift(name, plan string, allowPlanChange bool) (bool, error) {
+	if plan == "" {
+		return false, nil
+	}
+
+	existingPlan, err := c.inventory.Plan(name)
 	if err != nil {
-		return err
+		return false, err
 	}
 
+	// Not every listing of the space carries the plan, in which case the service itself is looked up
+	if existingPlan == "" {
+		service, err := c.getService(name)
+		if err != nil {
+			return false, err
+		}
+		existingPlan = service.ServicePlan.Name
+	}
+
+	if existingPlan == "" || existingPlan == plan {
+		return false, nil
+	}
+
+	if allowPlanChange {
+		fmt.Printf("plan will be changed from %s to %s...", existingPlan, plan)
+		return true, nil
+	}
+
+	fmt.Printf("WARNING: plan drift detected. The existing plan is %s, but the services manifest specifies %s. "+
+		"Plan changes are not allowed; set allowPlanChange: true or use --allow-plan-changes to change the plan.\n%s - ",
+		existingPlan, plan, name)
+	return false, nil
+}
+
+// waitForService polls the last operation of a service until it has either succeeded, failed or timed out.
+func (c *ServiceCreator) waitForService(poller *lastOperationPoller) error {
 	// Now wait for the service creation to complete.
-	// We wait 'infinitely' here because we don't know how long the service
-	// will take to complete. There exists some service brokers where
+	// Unless a timeout is given, we wait 'infinitely' here because we don't know how long
+	// the service will take to complete. There exists some service brokers where
 	// provisioning requires user ticket approval input to complete.
 	for {
-		service, err := c.cf.GetService(name)
-		if err != nil {
+		done, err := c.checkLastOperation(poller)
+		if done || err != nil {
 			return err
 		}
 
-		c.progressReporter.Step(service.LastOperation.Description)
+		now := time.Now()
+		if poller.timedOut(now) {
+			return poller.timeoutError()
+		}
+
+		poller.scheduleNextPoll(now)
+		time.Sleep(poller.nextPoll.Sub(now))
+	}
+}
+
+// checkLastOperation queries the last operation of a service once and reports its progress.
+// It returns true once the operation has succeeded. A failed operation is returned as an error.
+func (c *ServiceCreator) checkLastOperation(poller *lastOperationPoller) (bool, error) {
+	service, err := c.getService(poller.name)
+	if err != nil {
+		return false, err
+	}
 
-		if service.LastOperation.State == "succeeded" {
-			break
-		} else if service.LastOperation.State == "failed" {
-			return fmt.Errorf(
-				"error %s [status: %s]",
-				service.LastOperation.Description,
-				service.LastOperation.State,
-			)
+	poller.lastState = service.LastOperation.State
+	poller.lastDescription = service.LastOperation.Description
+	poller.progressReporter.Step(service.LastOperation.Description)
+
+	if service.LastOperation.State == "succeeded" {
+		return true, nil
+	} else if service.LastOperation.State == "failed" {
+		return false, &lastOperationFailure{
+			name:        poller.name,
+			operation:   service.LastOperation.Type,
+			description: service.LastOperation.Description,
 		}
 	}
 
-	return nil
+	return false, nil
 }
@@ -1,6 +1,13 @@
 package serviceCreator_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"code.cloudfoundry.org/cli/plugin/models"
 	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
 	. "github.com/onsi/ginkgo"
@@ -21,7 +28,7 @@ var _ = Describe("ServiceCreator", func() {
 	})
 
 	It("serviceCreator should still work without errors on an empty manifest", func() {
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 	})
 
@@ -39,7 +46,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
 
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 
 	})
@@ -64,12 +71,12 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
 				"create-service", "p-mysql", "standard", "MyService",
-				"-t", "\"blah, cool\"", "-c", "{\"git\":\"www.git.com\"}"}))
+				"-t", "blah, cool", "-c", "{\"git\":\"www.git.com\"}"}))
 	})
 
 	It("serviceCreator should be able to create a brokered service, even with updateServices true, with a blank type succesfully", func() {
@@ -92,12 +99,12 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
 				"create-service", "p-mysql", "standard", "MyService",
-				"-t", "\"blah, cool\"", "-c", "{\"git\":\"www.git.com\"}"}))
+				"-t", "blah, cool", "-c", "{\"git\":\"www.git.com\"}"}))
 	})
 
 	It("serviceCreator should fail on create-service if cf plugin wasn't able to query the services from CloudFoundry", func() {
@@ -121,7 +128,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -147,7 +154,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 	})
 
@@ -172,7 +179,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeTrue())
 		Expect(err).Should(HaveOccurred())
@@ -198,12 +205,12 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
 				"create-service", "p-mysql", "standard", "MyService",
-				"-t", "\"blah, cool\"", "-c", "{\"git\":\"www.git.com\"}"}))
+				"-t", "blah, cool", "-c", "{\"git\":\"www.git.com\"}"}))
 	})
 
 	It("serviceCreator should not create the brokered service again if it already exists and we don't want to update it", func() {
@@ -232,7 +239,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -263,12 +270,12 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
 				"update-service", "MyService",
-				"-t", "\"blah, cool\"", "-c", "{\"git\":\"www.git.com\"}"}))
+				"-t", "blah, cool", "-c", "{\"git\":\"www.git.com\"}"}))
 	})
 
 	It("serviceCreator should not get stuck in progress loop if an error occurred", func() {
@@ -291,7 +298,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 	})
 
@@ -310,7 +317,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -334,7 +341,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -358,7 +365,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 		mockCFPlugin.SimulateErrorOnGetServices = true
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -390,7 +397,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -422,7 +429,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -441,7 +448,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -460,7 +467,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -480,7 +487,7 @@ var _ = Describe("ServiceCreator", func() {
 
 		mockCFPlugin.SimulateErrorOnGetServices = true
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -507,7 +514,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -534,7 +541,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -553,7 +560,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -572,7 +579,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -592,7 +599,7 @@ var _ = Describe("ServiceCreator", func() {
 
 		mockCFPlugin.SimulateErrorOnGetServices = true
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -619,7 +626,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -646,7 +653,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(mockCFPlugin.CommandOutput).Should(Equal(
 			[]string{
@@ -677,7 +684,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -704,7 +711,7 @@ var _ = Describe("ServiceCreator", func() {
 			},
 		}
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
 	})
@@ -719,7 +726,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 	})
 
@@ -733,7 +740,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 	})
 
@@ -747,7 +754,7 @@ var _ = Describe("ServiceCreator", func() {
 		}
 
 		(*mockServiceManifest).Services = append((*mockServiceManifest).Services, brokeredService)
-		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin)
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
 		Expect(err).Should(HaveOccurred())
 	})
 
@@ -790,4 +797,1740 @@ var _ = Describe("ServiceCreator", func() {
 		progressReporter.Step("Finished!")
 		Expect(outputBufferString).Should(Equal("Finished!\n/\r"))
 	})
+
+	It("serviceCreator should not run any CLI commands on a dry run and should plan each service", func() {
+		existingServiceName := "MyExistingService"
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:    "MyService",
+				Broker:         "p-mysql",
+				PlanName:       "standard",
+				JSONParameters: "{\"git\":\"www.git.com\"}",
+			},
+			serviceManifest.Service{
+				ServiceName: existingServiceName,
+				Type:        "credentials",
+				Credentials: map[string]string{"host": "www.david.com"},
+			},
+			serviceManifest.Service{
+				ServiceName:   "MyDrain",
+				Type:          "drain",
+				URL:           "syslog-tls://server.myapp.com:1020",
+				UpdateService: true,
+			},
+		)
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: existingServiceName},
+			plugin_models.GetServices_Model{Name: "MyDrain"})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{DryRun: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator's plan should print each service action and command", func() {
+		var outputBufferString string
+		mockLogFunction := func(format string, a ...interface{}) (n int, err error) {
+			outputBufferString += fmt.Sprintf(format, a...)
+			return 0, nil
+		}
+
+		plan := NewPlan()
+		plan.Add("MyService", PlanCreate, []string{"create-service", "p-mysql", "standard", "MyService"})
+		plan.Add("MyExistingService", PlanSkip, nil)
+		plan.Print(mockLogFunction)
+
+		Expect(outputBufferString).Should(ContainSubstring("create   MyService         cf create-service p-mysql standard MyService\n"))
+		Expect(outputBufferString).Should(ContainSubstring("skip     MyExistingService -\n"))
+	})
+
+	It("serviceCreator should start all brokered services in parallel and fail if any of them failed", func() {
+		for _, name := range []string{"MyService1", "MyService2", "MyService3"} {
+			(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+				serviceManifest.Service{
+					ServiceName: name,
+					Broker:      "p-mysql",
+					PlanName:    "standard",
+				})
+		}
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+		mockCFPlugin.GetServiceModelsByName = map[string]plugin_models.GetService_Model{
+			"MyService2": plugin_models.GetService_Model{
+				LastOperation: plugin_models.GetService_LastOperation{
+					State:       "failed",
+					Description: "broker exploded",
+				},
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Parallel: 2})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("MyService2"))
+		Expect(err.Error()).ShouldNot(ContainSubstring("MyService1"))
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"create-service", "p-mysql", "standard", "MyService1"},
+			{"create-service", "p-mysql", "standard", "MyService2"},
+			{"create-service", "p-mysql", "standard", "MyService3"},
+		}))
+	})
+
+	It("serviceCreator should succeed in parallel when all services succeeded", func() {
+		for _, name := range []string{"MyService1", "MyService2"} {
+			(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+				serviceManifest.Service{
+					ServiceName: name,
+					Broker:      "p-mysql",
+					PlanName:    "standard",
+				})
+		}
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Parallel: 4})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(len(mockCFPlugin.CommandHistory)).Should(Equal(2))
+	})
+
+	It("serviceCreator's results should print a table and only report failures as an error", func() {
+		var outputBufferString string
+		mockLogFunction := func(format string, a ...interface{}) (n int, err error) {
+			outputBufferString += fmt.Sprintf(format, a...)
+			return 0, nil
+		}
+
+		results := NewResults()
+		results.Add("MyService", PlanCreate, ResultSucceeded, "")
+		Expect(results.Err()).ShouldNot(HaveOccurred())
+
+		results.Add("MyOtherService", PlanUpdate, ResultFailed, "boom")
+		results.Print(mockLogFunction)
+		Expect(outputBufferString).Should(ContainSubstring("MyOtherService update   failed     boom\n"))
+		Expect(results.Err()).Should(MatchError("1 service(s) failed:\nMyOtherService: boom"))
+	})
+
+	It("serviceCreator should create dependencies first", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "Credentials-UPS",
+				Type:        "credentials",
+				Credentials: map[string]string{"uri": "https://config.example.com"},
+				DependsOn:   []string{"my-configserver"},
+			},
+			serviceManifest.Service{
+				ServiceName: "my-configserver",
+				Broker:      "p-config-server",
+				PlanName:    "standard",
+			})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"create-service", "p-config-server", "standard", "my-configserver"},
+			{"cups", "Credentials-UPS", "-p", "{\"uri\":\"https://config.example.com\"}"},
+		}))
+	})
+
+	It("serviceCreator should not start a service in parallel when its dependency failed", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "my-configserver",
+				Broker:      "p-config-server",
+				PlanName:    "standard",
+			},
+			serviceManifest.Service{
+				ServiceName: "my-database",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+			},
+			serviceManifest.Service{
+				ServiceName: "Credentials-UPS",
+				Type:        "credentials",
+				Credentials: map[string]string{"uri": "https://config.example.com"},
+				DependsOn:   []string{"my-configserver"},
+			})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "failed",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Parallel: 4})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("Credentials-UPS: not created because the service it depends on, my-configserver, failed"))
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"create-service", "p-config-server", "standard", "my-configserver"},
+			{"create-service", "p-mysql", "standard", "my-database"},
+		}))
+	})
+
+	It("serviceCreator should time out waiting on a brokered service and name its last operation", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:  "MyService",
+				Broker:       "p-mysql",
+				PlanName:     "standard",
+				Timeout:      "20ms",
+				PollInterval: "1ms",
+			})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State:       "in progress",
+				Description: "waiting for ticket approval",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{ServiceTimeout: time.Hour})
+		Expect(err).Should(MatchError("timed out after 20ms waiting for service MyService to complete. Last reported operation: waiting for ticket approval"))
+	})
+
+	It("serviceCreator should time out in parallel using the global timeout", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyService",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+			})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "in progress",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin,
+			Options{Parallel: 2, ServiceTimeout: 20 * time.Millisecond, PollInterval: time.Millisecond})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("timed out after 20ms waiting for service MyService to complete. Last reported operation: none reported"))
+	})
+
+	It("serviceCreator should fail on an invalid service timeout", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyService",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+				Timeout:     "forever",
+			})
+		mockCFPlugin.GetServiceExists = true
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("serviceCreator should change the plan of an existing brokered service when plan changes are allowed", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:     "MyService",
+				Broker:          "p-mysql",
+				PlanName:        "large",
+				AllowPlanChange: true,
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			Name:        "MyService",
+			ServicePlan: plugin_models.GetService_ServicePlan{Name: "small"},
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandOutput).Should(Equal([]string{"update-service", "MyService", "-p", "large"}))
+	})
+
+	It("serviceCreator should change the plan along with the parameters when updating and --allow-plan-changes is used", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:    "MyService",
+				Broker:         "p-mysql",
+				PlanName:       "large",
+				UpdateService:  true,
+				JSONParameters: "{\"git\":\"www.git.com\"}",
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			Name:        "MyService",
+			ServicePlan: plugin_models.GetService_ServicePlan{Name: "small"},
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{AllowPlanChanges: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandOutput).Should(Equal(
+			[]string{"update-service", "MyService", "-p", "large", "-c", "{\"git\":\"www.git.com\"}"}))
+	})
+
+	It("serviceCreator should not change the plan of an existing brokered service unless plan changes are allowed", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:   "MyService",
+				Broker:        "p-mysql",
+				PlanName:      "large",
+				UpdateService: true,
+				Tags:          "blah",
+			},
+			serviceManifest.Service{
+				ServiceName: "MyOtherService",
+				Broker:      "p-mysql",
+				PlanName:    "large",
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"},
+			plugin_models.GetServices_Model{Name: "MyOtherService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			ServicePlan: plugin_models.GetService_ServicePlan{Name: "small"},
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"update-service", "MyService", "-t", "blah"},
+		}))
+	})
+
+	It("serviceCreator should unbind and delete a service marked absent when pruning is confirmed", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyOldService",
+				State:       "absent",
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyOldService", ApplicationNames: []string{"app1", "app2"}})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{ConfirmPrune: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"unbind-service", "app1", "MyOldService"},
+			{"unbind-service", "app2", "MyOldService"},
+			{"delete-service", "MyOldService", "-f"},
+		}))
+	})
+
+	It("serviceCreator should not delete a service marked absent unless pruning is confirmed", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyOldService",
+				State:       "absent",
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyOldService"})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(MatchError(ContainSubstring("MyOldService (marked absent)")))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should fail when a service marked absent fails to delete", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyOldService",
+				State:       "absent",
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyOldService"})
+		mockCFPlugin.SimulateErrorOnCliCommand = true
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{ConfirmPrune: true})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("serviceCreator should prune only services managed by the same owner that are no longer in the manifest", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyService",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+				Tags:        "blah",
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyManagedService", Guid: "guid-1"},
+			plugin_models.GetServices_Model{Name: "MyUnmanagedService", Guid: "guid-2", IsUserProvided: true},
+			plugin_models.GetServices_Model{Name: "OtherOwnersService", Guid: "guid-3"},
+			plugin_models.GetServices_Model{Name: "UnownedService", Guid: "guid-4"})
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/service_instances/guid-1":               "{\"entity\":{\"tags\":[\"" + ManagedTag + ":orders\"]}}",
+			"/v2/user_provided_service_instances/guid-2": "{\"entity\":{\"tags\":[]}}",
+			"/v2/service_instances/guid-3":               "{\"entity\":{\"tags\":[\"" + ManagedTag + ":billing\"]}}",
+			"/v2/service_instances/guid-4":               "{\"entity\":{\"tags\":[\"" + ManagedTag + "\"]}}",
+			"/v2/service_instances/guid-1/service_keys?results-per-page=100": "{\"resources\":[" +
+				"{\"entity\":{\"name\":\"reporting\"}},{\"entity\":{\"name\":\"dashboard\"}}]}",
+			"/v2/service_instances/guid-1/shared_to?results-per-page=100": "{\"resources\":[" +
+				"{\"organization_name\":\"team-a\",\"space_name\":\"dev\"}]}",
+		}
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Prune: true, PruneOwner: "orders", ConfirmPrune: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"create-service", "p-mysql", "standard", "MyService", "-t", "blah, " + ManagedTag + ":orders"},
+			{"delete-service-key", "MyManagedService", "dashboard", "-f"},
+			{"delete-service-key", "MyManagedService", "reporting", "-f"},
+			{"unshare-service", "MyManagedService", "-s", "dev", "-o", "team-a", "-f"},
+			{"delete-service", "MyManagedService", "-f"},
+		}))
+	})
+
+	It("serviceCreator should not prune without a prune owner", func() {
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Prune: true, ConfirmPrune: true})
+		Expect(err).Should(MatchError(ContainSubstring("pruning requires a prune owner")))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should create the service keys of a brokered service once it has succeeded", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyService",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+				ServiceKeys: []serviceManifest.ServiceKey{
+					{Name: "dashboard-key"},
+					{Name: "migration-key", JSONParameters: "{\"role\":\"admin\"}"},
+				},
+			})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"create-service", "p-mysql", "standard", "MyService"},
+			{"create-service-key", "MyService", "dashboard-key"},
+			{"create-service-key", "MyService", "migration-key", "-c", "{\"role\":\"admin\"}"},
+		}))
+	})
+
+	It("serviceCreator should only recreate existing service keys that ask for it when updating", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:   "MyService",
+				Broker:        "p-mysql",
+				PlanName:      "standard",
+				UpdateService: true,
+				ServiceKeys: []serviceManifest.ServiceKey{
+					{Name: "dashboard-key"},
+					{Name: "migration-key", Recreate: true},
+					{Name: "new-key"},
+				},
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService", Guid: "guid-1"})
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/service_instances/guid-1/service_keys?results-per-page=100": "{\"resources\":[" +
+				"{\"entity\":{\"name\":\"dashboard-key\"}}]," +
+				"\"next_url\":\"/v2/service_instances/guid-1/service_keys?page=2&results-per-page=100\"}",
+			"/v2/service_instances/guid-1/service_keys?page=2&results-per-page=100": "{\"resources\":[" +
+				"{\"entity\":{\"name\":\"migration-key\"}}],\"next_url\":null}",
+		}
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Parallel: 2})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"update-service", "MyService"},
+			{"delete-service-key", "MyService", "migration-key", "-f"},
+			{"create-service-key", "MyService", "migration-key"},
+			{"create-service-key", "MyService", "new-key"},
+		}))
+	})
+
+	It("serviceCreator should bind services to their apps and restage only the apps with new bindings", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:       "MyDatabase",
+				Broker:            "p-mysql",
+				PlanName:          "standard",
+				BindTo:            []string{"app1", "app2"},
+				BindingParameters: "{\"role\":\"read-only\"}",
+			},
+			serviceManifest.Service{
+				ServiceName: "MyCredentials",
+				Type:        "credentials",
+				BindTo:      []string{"app1", "app3"},
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyDatabase", ApplicationNames: []string{"app2"}},
+			plugin_models.GetServices_Model{Name: "MyCredentials", ApplicationNames: []string{"app3"}})
+
+		err := serviceCreatorCmd.BindServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"bind-service", "app1", "MyDatabase", "-c", "{\"role\":\"read-only\"}"},
+			{"bind-service", "app1", "MyCredentials"},
+			{"restage", "app1"},
+		}))
+	})
+
+	It("serviceCreator should not restage bound apps that were pushed with --no-start", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyDatabase",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+				BindTo:      []string{"app1"},
+			})
+
+		err := serviceCreatorCmd.BindServices(mockServiceManifest, mockCFPlugin, Options{NoStart: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"bind-service", "app1", "MyDatabase"},
+		}))
+	})
+
+	It("serviceCreator should not bind anything on a dry run", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyDatabase",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+				BindTo:      []string{"app1"},
+			})
+
+		err := serviceCreatorCmd.BindServices(mockServiceManifest, mockCFPlugin, Options{DryRun: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should share a brokered service into the spaces it isn't shared to yet", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyMessaging",
+				Broker:      "p-rabbitmq",
+				PlanName:    "standard",
+				ShareTo:     []string{"team-a/dev", "team-b/dev"},
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyMessaging", Guid: "guid-1"})
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/service_instances/guid-1/shared_to?results-per-page=100": "{\"resources\":[" +
+				"{\"organization_name\":\"team-c\",\"space_name\":\"dev\"}]," +
+				"\"next_url\":\"/v2/service_instances/guid-1/shared_to?page=2&results-per-page=100\"}",
+			"/v2/service_instances/guid-1/shared_to?page=2&results-per-page=100": "{\"resources\":[" +
+				"{\"organization_name\":\"team-a\",\"space_name\":\"dev\"}],\"next_url\":null}",
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"share-service", "MyMessaging", "-s", "dev", "-o", "team-b"},
+		}))
+	})
+
+	It("serviceCreator should unshare a brokered service from unlisted spaces when asked to", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:     "MyMessaging",
+				Broker:          "p-rabbitmq",
+				PlanName:        "standard",
+				ShareTo:         []string{"team-a/dev"},
+				UnshareUnlisted: true,
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyMessaging", Guid: "guid-1"})
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/service_instances/guid-1/shared_to?results-per-page=100": "{\"resources\":[" +
+				"{\"organization_name\":\"team-c\",\"space_name\":\"dev\"},{\"organization_name\":\"team-a\",\"space_name\":\"dev\"}," +
+				"{\"organization_name\":\"team-b\",\"space_name\":\"test\"}]}",
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"unshare-service", "MyMessaging", "-s", "test", "-o", "team-b", "-f"},
+			{"unshare-service", "MyMessaging", "-s", "dev", "-o", "team-c", "-f"},
+		}))
+	})
+
+	It("serviceCreator should fail before creating a brokered service with parameters that aren't valid JSON", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:    "MyService",
+				Broker:         "p-mysql",
+				PlanName:       "standard",
+				JSONParameters: "{\"RAM\": 4gb }",
+			})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(MatchError(ContainSubstring("the parameters of service MyService are not valid JSON")))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should pass tags to user provided services", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "Credentials-UPS",
+				Type:        "credentials",
+				Credentials: map[string]string{"uri": "https://config.example.com"},
+				Tags:        "config, shared",
+			},
+			serviceManifest.Service{
+				ServiceName:   "Drain-UPS",
+				Type:          "drain",
+				URL:           "syslog://logs.example.com",
+				UpdateService: true,
+				Tags:          "logs",
+			})
+
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "Drain-UPS"})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"cups", "Credentials-UPS", "-p", "{\"uri\":\"https://config.example.com\"}", "-t", "config, shared"},
+			{"uups", "Drain-UPS", "-l", "syslog://logs.example.com", "-t", "logs"},
+		}))
+	})
+
+	It("serviceCreator should pass structured credentials to cups as JSON", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "Credentials-UPS",
+				Type:        "credentials",
+				Credentials: map[string]interface{}{
+					"port":     8443,
+					"ssl":      true,
+					"profiles": []interface{}{"cloud", "production"},
+					"client":   map[string]interface{}{"id": "my-app"},
+				},
+			})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandOutput[:3]).Should(Equal([]string{"cups", "Credentials-UPS", "-p"}))
+		Expect(mockCFPlugin.CommandOutput[3]).Should(MatchJSON(
+			"{\"port\":8443,\"ssl\":true,\"profiles\":[\"cloud\",\"production\"],\"client\":{\"id\":\"my-app\"}}"))
+	})
+
+	It("serviceCreator should record a fingerprint on update and skip the next update when the manifest is unchanged", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:    "MyService",
+				Broker:         "p-mysql",
+				PlanName:       "standard",
+				UpdateService:  true,
+				JSONParameters: "{\"git\": \"www.git.com\"}",
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService", Guid: "guid-1"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			Guid: "guid-1",
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"update-service", "MyService", "-c", "{\"git\": \"www.git.com\"}"},
+		}))
+
+		labelCommand := mockCFPlugin.SilentCommandHistory[len(mockCFPlugin.SilentCommandHistory)-1]
+		Expect(labelCommand[:4]).Should(Equal([]string{"curl", "-X", "PATCH", "/v3/service_instances/guid-1"}))
+		Expect(labelCommand[5]).Should(ContainSubstring(FingerprintLabel))
+
+		// The service now carries the fingerprint of the manifest, so it is not updated again
+		mockCFPlugin.CurlResponses = map[string]string{"/v3/service_instances/guid-1": labelCommand[5]}
+		mockCFPlugin.CommandHistory = nil
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{DryRun: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(BeEmpty())
+
+		// Reformatting the parameters is not a change, but changing their values is
+		(*mockServiceManifest).Services[0].JSONParameters = "{\"git\":\"www.git.com\"}"
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(BeEmpty())
+
+		(*mockServiceManifest).Services[0].JSONParameters = "{\"git\":\"www.github.com\"}"
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"update-service", "MyService", "-c", "{\"git\":\"www.github.com\"}"},
+		}))
+	})
+
+	It("serviceCreator should leave credentials out of the fingerprint and compare them with those of the service", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:   "Credentials-UPS",
+				Type:          "credentials",
+				UpdateService: true,
+				Credentials:   map[string]interface{}{"password": "hunter2"},
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "Credentials-UPS", Guid: "guid-1", IsUserProvided: true})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{Guid: "guid-1", IsUserProvided: true}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(HaveLen(1))
+		labelCommand := mockCFPlugin.SilentCommandHistory[len(mockCFPlugin.SilentCommandHistory)-1]
+		Expect(labelCommand[5]).Should(ContainSubstring(FingerprintLabel))
+
+		// The fingerprint is the same for any credentials, so a service with the credentials in the manifest is unchanged
+		(*mockServiceManifest).Services[0].Credentials = map[string]interface{}{"password": "correct-horse"}
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v3/service_instances/guid-1":             labelCommand[5],
+			"/v3/service_instances/guid-1/credentials": "{\"password\": \"correct-horse\"}",
+		}
+		mockCFPlugin.CommandHistory = nil
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(BeEmpty())
+
+		// Credentials that differ from those of the service are a change
+		mockCFPlugin.CurlResponses["/v3/service_instances/guid-1/credentials"] = "{\"password\": \"hunter2\"}"
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"uups", "Credentials-UPS", "-p", "{\"password\":\"correct-horse\"}"},
+		}))
+	})
+
+	It("serviceCreator's plan should report unchanged services", func() {
+		plan := NewPlan()
+		plan.Add("MyService", PlanUnchanged, nil)
+
+		var output string
+		plan.Print(func(format string, args ...interface{}) (int, error) {
+			output += fmt.Sprintf(format, args...)
+			return 0, nil
+		})
+		Expect(output).Should(ContainSubstring("unchanged MyService -"))
+	})
+
+	It("serviceCreator should record the outcome and final last operation of each service", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"},
+			serviceManifest.Service{ServiceName: "MyExistingService", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyExistingService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State:       "succeeded",
+				Description: "create succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		results := serviceCreatorCmd.Results()
+		Expect(results.Entries).Should(HaveLen(2))
+		Expect(results.Entries[0].ServiceName).Should(Equal("MyService"))
+		Expect(results.Entries[0].Action).Should(Equal(PlanCreate))
+		Expect(results.Entries[0].Status).Should(Equal(ResultSucceeded))
+		Expect(results.Entries[0].LastOperationState).Should(Equal("succeeded"))
+		Expect(results.Entries[0].LastOperationDescription).Should(Equal("create succeeded"))
+		Expect(results.Entries[1].ServiceName).Should(Equal("MyExistingService"))
+		Expect(results.Entries[1].Action).Should(Equal(PlanSkip))
+		Expect(results.Entries[1].LastOperationState).Should(Equal(""))
+	})
+
+	It("serviceCreator should attempt every service and report all failures together with KeepGoing", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyBrokenService", Broker: "p-mysql", PlanName: "standard", JSONParameters: "{\"RAM\": 4gb }"},
+			serviceManifest.Service{ServiceName: "MyDependentService", Broker: "p-mysql", PlanName: "standard", DependsOn: []string{"MyBrokenService"}},
+			serviceManifest.Service{ServiceName: "MyBadRouteService", Type: "route", URL: "http://www.route.com"},
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{KeepGoing: true})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(HavePrefix("3 service(s) failed:\n"))
+		Expect(err.Error()).Should(ContainSubstring("MyBrokenService: the parameters of service MyBrokenService are not valid JSON"))
+		Expect(err.Error()).Should(ContainSubstring("MyDependentService: not created because the service it depends on, MyBrokenService, failed"))
+		Expect(err.Error()).Should(ContainSubstring("MyBadRouteService: route scheme not specified or unsupported"))
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"create-service", "p-mysql", "standard", "MyService"},
+		}))
+	})
+
+	It("serviceCreator should stop at the first failure without KeepGoing", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyBadRouteService", Type: "route", URL: "http://www.route.com"},
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should retry cf commands that fail while another operation is in progress on the service", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard", UpdateService: true})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels, plugin_models.GetServices_Model{
+			Name: "MyService", ServicePlan: plugin_models.GetServices_ServicePlan{Name: "standard"}})
+		// The cf CLI passes on the same error for every failed command, whatever the reason
+		mockCFPlugin.CliCommandErrors = []error{
+			fmt.Errorf("Error executing cli core command"),
+			fmt.Errorf("Error executing cli core command"),
+		}
+		succeeded := plugin_models.GetService_Model{LastOperation: plugin_models.GetService_LastOperation{State: "succeeded"}}
+		inProgress := plugin_models.GetService_Model{LastOperation: plugin_models.GetService_LastOperation{Type: "update", State: "in progress"}}
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceErrors = []error{fmt.Errorf("Invalid auth token: invalid_token")}
+		mockCFPlugin.GetServiceModelQueue = []plugin_models.GetService_Model{succeeded, succeeded, inProgress, inProgress}
+		mockCFPlugin.GetServiceModel = succeeded
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Retries: 2, RetryDelay: time.Millisecond})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"update-service", "MyService"},
+			{"update-service", "MyService"},
+			{"update-service", "MyService"},
+		}))
+	})
+
+	It("serviceCreator should not retry permanent errors, nor retry more often than allowed", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "huge"})
+		mockCFPlugin.CliCommandErrors = []error{fmt.Errorf("Error executing cli core command")}
+
+		// A failed command on a service without an operation in progress can't be told apart from a permanent error
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Retries: 2, RetryDelay: time.Millisecond})
+		Expect(err).Should(MatchError("Error executing cli core command"))
+		Expect(mockCFPlugin.CommandHistory).Should(HaveLen(1))
+
+		(*mockServiceManifest).Services[0].Retries = 1
+		mockCFPlugin.CommandHistory = nil
+		mockCFPlugin.CliCommandErrors = []error{fmt.Errorf("Error executing cli core command"), fmt.Errorf("Error executing cli core command")}
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{LastOperation: plugin_models.GetService_LastOperation{State: "in progress"}}
+
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Retries: 5, RetryDelay: time.Millisecond})
+		Expect(err).Should(MatchError("Error executing cli core command: another operation for service instance MyService is in progress"))
+		Expect(mockCFPlugin.CommandHistory).Should(HaveLen(2))
+	})
+
+	It("serviceCreator should not retry a read whose error merely mentions a retryable word", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "session-timeout-db", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels, plugin_models.GetServices_Model{Name: "session-timeout-db"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceErrors = []error{
+			fmt.Errorf("Service instance session-timeout-db not found"),
+			fmt.Errorf("Invalid auth token: invalid_token"),
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Retries: 2, RetryDelay: time.Millisecond})
+		Expect(err).Should(MatchError(ContainSubstring("Service instance session-timeout-db not found")))
+		Expect(mockCFPlugin.GetServiceErrors).Should(HaveLen(1))
+	})
+
+	It("serviceCreator should fail on an existing service whose last operation failed, rather than skip it", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				Type:        "create",
+				State:       "failed",
+				Description: "broker exploded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(HavePrefix("service MyService exists, but its last operation failed: broker exploded"))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+
+		// A failed update is never recreated, since the service would lose its data
+		(*mockServiceManifest).Services[0].OnFailure = "recreate"
+		mockCFPlugin.GetServiceModel.LastOperation.Type = "update"
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should leave an existing failed service as it is with onFailure: ignore", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName:   "MyService",
+				Broker:        "p-mysql",
+				PlanName:      "standard",
+				OnFailure:     "ignore",
+				UpdateService: true,
+				ServiceKeys:   []serviceManifest.ServiceKey{{Name: "reporting"}},
+				ShareTo:       []string{"team-a/dev"},
+				Labels:        map[string]string{"team": "orders"},
+			})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				Type:        "create",
+				State:       "failed",
+				Description: "broker exploded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+
+		err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Parallel: 2})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should delete and create again an existing service whose create failed with onFailure: recreate", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard", OnFailure: "recreate"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				Type:        "create",
+				State:       "failed",
+				Description: "broker exploded",
+			},
+		}
+		mockCFPlugin.CreatedServiceModel = &plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				Type:  "create",
+				State: "succeeded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"delete-service", "MyService", "-f"},
+			{"create-service", "p-mysql", "standard", "MyService"},
+		}))
+	})
+
+	It("serviceCreator should plan to delete and create again a failed service on a dry run with onFailure: recreate", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard", OnFailure: "recreate"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				Type:  "create",
+				State: "failed",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{DryRun: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should not fail, nor complete the service, when its create fails with onFailure: ignore", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{
+				ServiceName: "MyService",
+				Broker:      "p-mysql",
+				PlanName:    "standard",
+				OnFailure:   "ignore",
+				ServiceKeys: []serviceManifest.ServiceKey{{Name: "dashboard-key"}},
+			})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.CreatedServiceModel = &plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{
+				Type:        "create",
+				State:       "failed",
+				Description: "broker exploded",
+			},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"create-service", "p-mysql", "standard", "MyService"},
+		}))
+	})
+
+	It("serviceCreator should wait for an earlier operation on an existing service before updating it", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard", UpdateService: true, PollInterval: "1ms"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModelQueue = []plugin_models.GetService_Model{
+			{LastOperation: plugin_models.GetService_LastOperation{Type: "update", State: "in progress", Description: "resizing"}},
+			{LastOperation: plugin_models.GetService_LastOperation{Type: "update", State: "in progress", Description: "resizing"}},
+		}
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{Type: "update", State: "succeeded"},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.GetServiceModelQueue).Should(BeEmpty())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"update-service", "MyService"},
+		}))
+	})
+
+	It("serviceCreator should handle an earlier operation that fails while it is waited on as an existing failure", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModelQueue = []plugin_models.GetService_Model{
+			{LastOperation: plugin_models.GetService_LastOperation{Type: "create", State: "in progress"}},
+		}
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{Type: "create", State: "failed", Description: "broker exploded"},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(HavePrefix("service MyService exists, but its last operation failed: broker exploded"))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should only report an earlier operation in progress on a dry run", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService"})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{Type: "update", State: "in progress"},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{DryRun: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should only list the services in the space once when nothing is changed", func() {
+		for _, name := range []string{"MyService1", "MyService2", "MyService3"} {
+			(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+				serviceManifest.Service{ServiceName: name, Broker: "p-mysql", PlanName: "standard"})
+			mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+				plugin_models.GetServices_Model{Name: name})
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+		Expect(mockCFPlugin.GetServicesCallCount).Should(Equal(1))
+	})
+
+	It("serviceCreator should list the services in the space again after a command changes them", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService1", Type: "credentials", Credentials: map[string]interface{}{"user": "admin"}},
+			serviceManifest.Service{ServiceName: "MyService2", Broker: "p-mysql", PlanName: "standard"},
+			serviceManifest.Service{ServiceName: "MyService3", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService2"},
+			plugin_models.GetServices_Model{Name: "MyService3"})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(HaveLen(1))
+		Expect(mockCFPlugin.GetServicesCallCount).Should(Equal(2))
+	})
+
+	It("inventory should describe the services in the space until it is invalidated", func() {
+		calls := 0
+		services := []plugin_models.GetServices_Model{
+			{
+				Name:        "MyService",
+				ServicePlan: plugin_models.GetServices_ServicePlan{Name: "standard"},
+				Service:     plugin_models.GetServices_ServiceFields{Name: "p-mysql"},
+			},
+			{Name: "MyUPS", IsUserProvided: true},
+		}
+		inventory := NewInventory(func(name string) ([]plugin_models.GetServices_Model, error) {
+			calls++
+			return services, nil
+		})
+
+		Expect(inventory.Exists("MyService")).Should(BeTrue())
+		Expect(inventory.Exists("NotMyService")).Should(BeFalse())
+		Expect(inventory.IsUserProvided("MyService")).Should(BeFalse())
+		Expect(inventory.IsUserProvided("MyUPS")).Should(BeTrue())
+		Expect(inventory.Plan("MyService")).Should(Equal("standard"))
+		Expect(inventory.Broker("MyService")).Should(Equal("p-mysql"))
+		Expect(inventory.Plan("MyUPS")).Should(BeEmpty())
+		Expect(calls).Should(Equal(1))
+
+		services = services[1:]
+		Expect(inventory.Exists("MyService")).Should(BeTrue())
+		inventory.Invalidate()
+		Expect(inventory.Exists("MyService")).Should(BeFalse())
+		Expect(inventory.All()).Should(HaveLen(1))
+		Expect(calls).Should(Equal(2))
+	})
+
+	It("inventory should not keep a failed listing", func() {
+		calls := 0
+		inventory := NewInventory(func(name string) ([]plugin_models.GetServices_Model, error) {
+			calls++
+			if calls == 1 {
+				return nil, fmt.Errorf("503 Service Unavailable")
+			}
+			return []plugin_models.GetServices_Model{{Name: "MyService"}}, nil
+		})
+
+		_, err := inventory.Exists("MyService")
+		Expect(err).Should(HaveOccurred())
+		Expect(inventory.Exists("MyService")).Should(BeTrue())
+	})
+
+	It("serviceCreator should fail on a user provided service that exists as a brokered service", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Type: "credentials", Credentials: map[string]interface{}{"user": "admin"}, UpdateService: true})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{
+				Name:        "MyService",
+				Service:     plugin_models.GetServices_ServiceFields{Name: "p-mysql"},
+				ServicePlan: plugin_models.GetServices_ServicePlan{Name: "standard"},
+			})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(Equal("service MyService conflicts with the existing instance of the same name: " +
+			"type is user provided (credentials) in the services manifest, but brokered in the space; " +
+			"broker is none in the services manifest, but p-mysql in the space; " +
+			"plan is none in the services manifest, but standard in the space"))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should fail on a brokered service that exists as a user provided service", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{Name: "MyService", IsUserProvided: true})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("type is brokered in the services manifest, but user provided in the space"))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should fail on a brokered service that exists with a different broker", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard", UpdateService: true})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{
+				Name:        "MyService",
+				Service:     plugin_models.GetServices_ServiceFields{Name: "p-postgres"},
+				ServicePlan: plugin_models.GetServices_ServicePlan{Name: "standard"},
+			})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(Equal("service MyService conflicts with the existing instance of the same name: " +
+			"broker is p-mysql in the services manifest, but p-postgres in the space"))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should not treat a different plan alone as a conflict", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Broker: "p-mysql", PlanName: "large", AllowPlanChange: true})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{
+				Name:        "MyService",
+				Service:     plugin_models.GetServices_ServiceFields{Name: "p-mysql"},
+				ServicePlan: plugin_models.GetServices_ServicePlan{Name: "small"},
+			})
+		mockCFPlugin.GetServiceExists = true
+		mockCFPlugin.GetServiceModel = plugin_models.GetService_Model{
+			LastOperation: plugin_models.GetService_LastOperation{State: "succeeded"},
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"update-service", "MyService", "-p", "large"},
+		}))
+	})
+
+	It("serviceCreator should skip a conflicting service with WarnOnConflicts", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyService", Type: "route", URL: "https://www.blah.com", UpdateService: true},
+			serviceManifest.Service{ServiceName: "MyOtherService", Type: "credentials", Credentials: map[string]interface{}{"user": "admin"}})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{
+				Name:    "MyService",
+				Service: plugin_models.GetServices_ServiceFields{Name: "p-mysql"},
+			})
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{WarnOnConflicts: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mockCFPlugin.CommandHistory).Should(Equal([][]string{
+			{"cups", "MyOtherService", "-p", "{\"user\":\"admin\"}"},
+		}))
+	})
+
+	It("serviceCreator should check the marketplace for the broker and plan of every brokered service", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyDatabase", Broker: "p-mysql", PlanName: "large"},
+			serviceManifest.Service{ServiceName: "MyCache", Broker: "p-redis", PlanName: "shared"},
+			serviceManifest.Service{ServiceName: "MyQueue", Broker: "p-rabbitmq", PlanName: "standard"},
+			serviceManifest.Service{ServiceName: "MyOldQueue", Broker: "p-rabbitmq", PlanName: "standard", State: "absent"},
+			serviceManifest.Service{ServiceName: "MyCredentials", Type: "credentials"})
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/spaces//services?results-per-page=100": `{"resources": [
+				{"entity": {"label": "p-mysql", "service_plans_url": "/v2/services/mysql-guid/service_plans"}}],
+				"next_url": "/v2/spaces//services?page=2&results-per-page=100"}`,
+			"/v2/spaces//services?page=2&results-per-page=100": `{"resources": [
+				{"entity": {"label": "p-redis", "service_plans_url": "/v2/services/redis-guid/service_plans"}}],
+				"next_url": null}`,
+			"/v2/services/mysql-guid/service_plans?results-per-page=100": `{"resources": [{"entity": {"name": "small"}}, {"entity": {"name": "large"}}]}`,
+			"/v2/services/redis-guid/service_plans?results-per-page=100": `{"resources": [{"entity": {"name": "dedicated"}}],
+				"next_url": "/v2/services/redis-guid/service_plans?page=2&results-per-page=100"}`,
+			"/v2/services/redis-guid/service_plans?page=2&results-per-page=100": `{"resources": [{"entity": {"name": "cache-small"}}]}`,
+		}
+
+		err := serviceCreatorCmd.CheckMarketplace(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(MatchError("the marketplace of the targeted space does not offer every service in the services manifest:\n" +
+			"  service MyCache: plan shared is not offered by broker p-redis. Its plans are cache-small, dedicated\n" +
+			"  service MyQueue: broker p-rabbitmq is not in the marketplace"))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+
+		(*mockServiceManifest).Services = (*mockServiceManifest).Services[:1]
+		err = serviceCreatorCmd.CheckMarketplace(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("serviceCreator should check the marketplace before creating any service and suggest close matches", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyCredentials", Type: "credentials", Credentials: map[string]interface{}{"user": "admin"}},
+			serviceManifest.Service{ServiceName: "MyDatabase", Broker: "p-mysql", PlanName: "larg"},
+			serviceManifest.Service{ServiceName: "MyCache", Broker: "p-reddis", PlanName: "shared"},
+			serviceManifest.Service{ServiceName: "MyOldDatabase", Broker: "p-mysql", PlanName: "retired"})
+		mockCFPlugin.GetServicesModels = append(mockCFPlugin.GetServicesModels,
+			plugin_models.GetServices_Model{
+				Name:        "MyOldDatabase",
+				Service:     plugin_models.GetServices_ServiceFields{Name: "p-mysql"},
+				ServicePlan: plugin_models.GetServices_ServicePlan{Name: "retired"},
+			})
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/spaces//services?results-per-page=100": `{"resources": [
+				{"entity": {"label": "p-mysql", "service_plans_url": "/v2/services/mysql-guid/service_plans"}},
+				{"entity": {"label": "p-redis", "service_plans_url": "/v2/services/redis-guid/service_plans"}}]}`,
+			"/v2/services/mysql-guid/service_plans?results-per-page=100": `{"resources": [{"entity": {"name": "small"}}, {"entity": {"name": "large"}}]}`,
+		}
+
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{CheckMarketplace: true})
+		Expect(err).Should(MatchError("the marketplace of the targeted space does not offer every service in the services manifest:\n" +
+			"  service MyDatabase: plan larg is not offered by broker p-mysql. Its plans are large, small. Did you mean large?\n" +
+			"  service MyCache: broker p-reddis is not in the marketplace. Did you mean p-redis?"))
+		Expect(mockCFPlugin.CliCommandWasCalled).Should(BeFalse())
+	})
+
+	It("serviceCreator should fail, rather than report the broker missing, when the Cloud Controller rejects a read of the marketplace", func() {
+		(*mockServiceManifest).Services = append((*mockServiceManifest).Services,
+			serviceManifest.Service{ServiceName: "MyDatabase", Broker: "p-mysql", PlanName: "large"})
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/spaces//services?results-per-page=100": `{"description": "You are not authorized to perform the requested action",
+				"error_code": "CF-NotAuthorized", "code": 10003}`,
+		}
+
+		err := serviceCreatorCmd.CheckMarketplace(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring(
+			"cf curl /v2/spaces//services?results-per-page=100 failed with CF-NotAuthorized: You are not authorized to perform the requested action"))
+		Expect(err.Error()).ShouldNot(ContainSubstring("is not in the marketplace"))
+
+		mockCFPlugin.CurlResponses = map[string]string{
+			"/v2/spaces//services?results-per-page=100": `{"errors": [{"detail": "You are not authorized to perform the requested action",
+				"title": "CF-NotAuthorized", "code": 10003}]}`,
+		}
+		err = serviceCreatorCmd.CheckMarketplace(mockServiceManifest, mockCFPlugin, Options{})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("failed with CF-NotAuthorized"))
+	})
+
+	It("serviceCreator should fail with a backend that isn't supported", func() {
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: "v2"})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("backend v2 is not supported"))
+	})
+
+	It("serviceCreator with the v3 backend should require a targeted space", func() {
+		mockCFPlugin.APIEndpoint = "https://api.example.com"
+		err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("no space is targeted"))
+	})
+
+	Context("with the v3 backend", func() {
+		var mockCC *MockCloudController
+		instanceList := func(instances ...string) MockResponse {
+			return MockResponse{Body: fmt.Sprintf(`{"pagination":{"next":null},"resources":[%s],"included":{
+				"service_plans":[{"guid":"plan-guid","name":"standard","relationships":{"service_offering":{"data":{"guid":"offering-guid"}}}}],
+				"service_offerings":[{"guid":"offering-guid","name":"p-mysql"}]}}`, strings.Join(instances, ","))}
+		}
+		instance := func(name, state string) string {
+			return fmt.Sprintf(`{"guid":"%s-guid","name":"%s","type":"managed","tags":[],
+				"last_operation":{"type":"create","state":"%s","description":"%s"},
+				"relationships":{"service_plan":{"data":{"guid":"plan-guid"}}}}`, name, name, state, state)
+		}
+
+		BeforeEach(func() {
+			mockCC = NewMockCloudController()
+			mockCFPlugin.APIEndpoint = mockCC.Server.URL
+			mockCFPlugin.AccessTokenValue = "bearer some-token"
+			mockCFPlugin.CurrentSpace = plugin_models.Space{SpaceFields: plugin_models.SpaceFields{Guid: "space-guid"}}
+		})
+
+		AfterEach(func() {
+			mockCC.Close()
+		})
+
+		It("should create a brokered service and wait for its job to complete", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{
+				ServiceName:    "MyService",
+				Broker:         "p-mysql",
+				PlanName:       "standard",
+				Tags:           "database, mysql",
+				JSONParameters: "{\"size\":2}",
+				Labels:         map[string]string{"team": "payments"},
+				Annotations:    map[string]string{"contact": "payments@example.com"},
+			}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{
+				instanceList(),
+				instanceList(instance("MyService", "in progress")),
+				instanceList(instance("MyService", "succeeded")),
+			}
+			mockCC.Responses["GET /v3/service_plans"] = []MockResponse{{Body: `{"pagination":{"next":null},"resources":[{"guid":"plan-guid","name":"standard"}]}`}}
+			mockCC.Responses["POST /v3/service_instances"] = []MockResponse{{Status: 202, Location: "/v3/jobs/job-guid"}}
+			mockCC.Responses["GET /v3/jobs/job-guid"] = []MockResponse{
+				{Body: `{"operation":"service_instance.create","state":"POLLING"}`},
+				{Body: `{"operation":"service_instance.create","state":"COMPLETE"}`},
+			}
+			mockCC.Responses["PATCH /v3/service_instances/MyService-guid"] = []MockResponse{{Body: `{}`}}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3, PollInterval: time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(mockCFPlugin.CommandHistory).Should(BeEmpty())
+
+			creates := mockCC.RequestsTo("POST /v3/service_instances")
+			Expect(creates).Should(HaveLen(1))
+			Expect(creates[0].Authorization).Should(Equal("bearer some-token"))
+			Expect(creates[0].Body).Should(MatchJSON(`{"type":"managed","name":"MyService","tags":["database","mysql"],"parameters":{"size":2},
+				"relationships":{"space":{"data":{"guid":"space-guid"}},"service_plan":{"data":{"guid":"plan-guid"}}}}`))
+			Expect(mockCC.RequestsTo("GET /v3/service_plans")[0].Query).Should(ContainSubstring("service_offering_names=p-mysql"))
+			Expect(mockCC.RequestsTo("GET /v3/jobs/job-guid")).Should(HaveLen(2))
+
+			patches := mockCC.RequestsTo("PATCH /v3/service_instances/MyService-guid")
+			Expect(patches).Should(HaveLen(1))
+			Expect(patches[0].Body).Should(MatchJSON(`{"metadata":{"labels":{"team":"payments"},"annotations":{"contact":"payments@example.com"}}}`))
+			Expect(serviceCreatorCmd.Results().Entries[0].LastOperationState).Should(Equal("succeeded"))
+		})
+
+		It("should report the errors of a failed job as the failed last operation", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard"}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList()}
+			mockCC.Responses["GET /v3/service_plans"] = []MockResponse{{Body: `{"pagination":{"next":null},"resources":[{"guid":"plan-guid","name":"standard"}]}`}}
+			mockCC.Responses["POST /v3/service_instances"] = []MockResponse{{Status: 202, Location: "/v3/jobs/job-guid"}}
+			mockCC.Responses["GET /v3/jobs/job-guid"] = []MockResponse{
+				{Body: `{"operation":"service_instance.create","state":"FAILED","errors":[{"detail":"The service broker rejected the request"}]}`},
+			}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3, PollInterval: time.Millisecond})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("The service broker rejected the request [status: failed]"))
+		})
+
+		It("should fail when the plan isn't in the marketplace", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyService", Broker: "p-mysql", PlanName: "huge"}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList()}
+			mockCC.Responses["GET /v3/service_plans"] = []MockResponse{{Body: `{"pagination":{"next":null},"resources":[]}`}}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("plan huge of service offering p-mysql was not found"))
+			Expect(mockCC.RequestsTo("POST /v3/service_instances")).Should(BeEmpty())
+		})
+
+		It("should create a user provided service", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{
+				ServiceName: "MyCredentials",
+				Type:        "credentials",
+				Credentials: map[string]interface{}{"password": "secret"},
+			}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList()}
+			mockCC.Responses["POST /v3/service_instances"] = []MockResponse{{Status: 201, Body: `{"guid":"MyCredentials-guid"}`}}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(mockCC.RequestsTo("POST /v3/service_instances")[0].Body).Should(MatchJSON(
+				`{"type":"user-provided","name":"MyCredentials","credentials":{"password":"secret"},"relationships":{"space":{"data":{"guid":"space-guid"}}}}`))
+		})
+
+		It("should change the plan of an existing service to a plan of the same offering", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyService", Broker: "p-mysql", PlanName: "large", AllowPlanChange: true}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList(instance("MyService", "succeeded"))}
+			mockCC.Responses["GET /v3/service_credential_bindings"] = []MockResponse{{Body: `{"pagination":{"next":null},"resources":[]}`}}
+			mockCC.Responses["GET /v3/service_plans"] = []MockResponse{{Body: `{"pagination":{"next":null},"resources":[{"guid":"large-guid","name":"large"}]}`}}
+			mockCC.Responses["PATCH /v3/service_instances/MyService-guid"] = []MockResponse{{Status: 202, Location: "/v3/jobs/job-guid"}}
+			mockCC.Responses["GET /v3/jobs/job-guid"] = []MockResponse{{Body: `{"operation":"service_instance.update","state":"COMPLETE"}`}}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3, PollInterval: time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(mockCC.RequestsTo("GET /v3/service_plans")[0].Query).Should(ContainSubstring("service_offering_guids=offering-guid"))
+			Expect(mockCC.RequestsTo("PATCH /v3/service_instances/MyService-guid")[0].Body).Should(MatchJSON(
+				`{"relationships":{"service_plan":{"data":{"guid":"large-guid"}}}}`))
+		})
+
+		It("should retry a request that fails with a retryable status", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyCredentials", Type: "credentials", Credentials: map[string]interface{}{}}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList()}
+			mockCC.Responses["POST /v3/service_instances"] = []MockResponse{
+				{Status: 503, Body: `{"errors":[{"detail":"Try again later"}]}`},
+				{Status: 201, Body: `{}`},
+			}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3, Retries: 1, RetryDelay: time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(mockCC.RequestsTo("POST /v3/service_instances")).Should(HaveLen(2))
+		})
+
+		It("should retry the reads of shares and the marketplace that fail with a retryable status", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyService", Broker: "p-mysql", PlanName: "standard",
+				ServiceKeys: []serviceManifest.ServiceKey{{Name: "reporting"}}, ShareTo: []string{"other-org/other-space"}}}
+			unavailable := MockResponse{Status: 503, Body: `{"errors":[{"detail":"Try again later","title":"CF-ServiceUnavailable"}]}`}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList(instance("MyService", "succeeded"))}
+			mockCC.Responses["GET /v3/service_plans"] = []MockResponse{unavailable, {Body: `{"pagination":{"next":null},
+				"resources":[{"guid":"plan-guid","name":"standard","relationships":{"service_offering":{"data":{"guid":"offering-guid"}}}}],
+				"included":{"service_offerings":[{"guid":"offering-guid","name":"p-mysql"}]}}`}}
+			mockCC.Responses["GET /v3/service_credential_bindings"] = []MockResponse{{Body: `{"pagination":{"next":null},"resources":[{"name":"reporting"}]}`}}
+			mockCC.Responses["GET /v3/service_instances/MyService-guid/relationships/shared_spaces"] = []MockResponse{unavailable,
+				{Body: `{"data":[{"guid":"other-space-guid"}],"included":{"spaces":[{"guid":"other-space-guid","name":"other-space",
+					"relationships":{"organization":{"data":{"guid":"other-org-guid"}}}}],"organizations":[{"guid":"other-org-guid","name":"other-org"}]}}`}}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin,
+				Options{Backend: BackendV3, CheckMarketplace: true, Retries: 1, RetryDelay: time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(mockCC.RequestsTo("GET /v3/service_plans")).Should(HaveLen(2))
+			Expect(mockCC.RequestsTo("GET /v3/service_instances/MyService-guid/relationships/shared_spaces")).Should(HaveLen(2))
+			Expect(mockCC.RequestsTo("POST /v3/service_credential_bindings")).Should(BeEmpty())
+		})
+
+		It("should retry on the status and the titles of the errors of a response, but not on the text of its path or details", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "session-timeout-db", Type: "credentials", Credentials: map[string]interface{}{}}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList()}
+			mockCC.Responses["POST /v3/service_instances"] = []MockResponse{
+				{Status: 409, Body: `{"errors":[{"detail":"An operation for service instance session-timeout-db is in progress.","title":"CF-AsyncServiceInstanceOperationInProgress"}]}`},
+				{Status: 422, Body: `{"errors":[{"detail":"Service offering p-geofence not found for session-timeout-db","title":"CF-UnprocessableEntity"}]}`},
+			}
+
+			options := Options{Backend: BackendV3, Retries: 3, RetryDelay: time.Millisecond}
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, options)
+			Expect(err).Should(MatchError(ContainSubstring("Service offering p-geofence not found")))
+			Expect(mockCC.RequestsTo("POST /v3/service_instances")).Should(HaveLen(2))
+
+			// The offering is part of the path of the plan lookup
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyService", Broker: "legacy-502", PlanName: "standard"}}
+			err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, options)
+			Expect(err).Should(MatchError(ContainSubstring("legacy-502")))
+			Expect(mockCC.RequestsTo("GET /v3/service_plans")).Should(HaveLen(1))
+		})
+
+		It("should check the marketplace with the v3 API", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyService", Broker: "p-mysql", PlanName: "huge"}}
+			mockCC.Responses["GET /v3/service_instances"] = []MockResponse{instanceList()}
+			mockCC.Responses["GET /v3/service_plans"] = []MockResponse{{Body: `{"pagination":{"next":null},
+				"resources":[{"guid":"plan-guid","name":"standard","relationships":{"service_offering":{"data":{"guid":"offering-guid"}}}}],
+				"included":{"service_offerings":[{"guid":"offering-guid","name":"p-mysql"}]}}`}}
+
+			err := serviceCreatorCmd.CheckMarketplace(mockServiceManifest, mockCFPlugin, Options{Backend: BackendV3})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("plan huge is not offered by broker p-mysql. Its plans are standard"))
+			Expect(mockCFPlugin.SilentCommandHistory).Should(BeEmpty())
+		})
+	})
+
+	Context("with the fake backend", func() {
+		var fake *FakeBackend
+		BeforeEach(func() {
+			fake = NewFakeBackend()
+			serviceCreatorCmd = NewServiceCreatorWithBackend(fake)
+		})
+
+		It("should create services and wait for their last operations to succeed", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{
+				{ServiceName: "MyDatabase", Broker: "p-mysql", PlanName: "100mb", Tags: "database", JSONParameters: "{\"size\":2}",
+					Labels: map[string]string{"team": "payments"}},
+				{ServiceName: "MyCredentials", Type: "credentials", Credentials: map[string]interface{}{"user": "admin"}},
+			}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{PollInterval: time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(mockCFPlugin.CommandHistory).Should(BeEmpty())
+
+			database := fake.Find("MyDatabase")
+			Expect(database).ShouldNot(BeNil())
+			Expect(database.Plan).Should(Equal("100mb"))
+			Expect(database.Parameters).Should(Equal("{\"size\":2}"))
+			Expect(database.Tags).Should(Equal([]string{"database"}))
+			Expect(database.Labels).Should(HaveKeyWithValue("team", "payments"))
+			Expect(database.LastOperation.State).Should(Equal("succeeded"))
+			Expect(fake.Find("MyCredentials").Type).Should(Equal("credentials"))
+
+			result, found := serviceCreatorCmd.Results().Find("MyDatabase")
+			Expect(found).Should(BeTrue())
+			Expect(result.Action).Should(Equal(PlanCreate))
+			Expect(result.Status).Should(Equal(ResultSucceeded))
+		})
+
+		It("should update the plan of an existing service", func() {
+			fake.PollsToComplete = 0
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyCache", Broker: "p-redis", PlanName: "shared"}}
+			Expect(serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})).Should(Succeed())
+
+			fake.PollsToComplete = 2
+			mockServiceManifest.Services[0].PlanName = "dedicated"
+			mockServiceManifest.Services[0].UpdateService = true
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{AllowPlanChanges: true, PollInterval: time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			cache := fake.Find("MyCache")
+			Expect(cache.Plan).Should(Equal("dedicated"))
+			Expect(cache.LastOperation.Type).Should(Equal("update"))
+			Expect(cache.LastOperation.State).Should(Equal("succeeded"))
+			Expect(fake.Services).Should(HaveLen(1))
+		})
+
+		It("should not report a service whose last operation failed as unchanged, even though its fingerprint matches", func() {
+			fake.PollsToComplete = 0
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyCache", Broker: "p-redis", PlanName: "shared", UpdateService: true}}
+			Expect(serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})).Should(Succeed())
+			Expect(fake.Find("MyCache").Labels).Should(HaveKey(FingerprintLabel))
+
+			cache := fake.Find("MyCache")
+			cache.LastOperation = plugin_models.GetService_LastOperation{Type: "update", State: "failed", Description: "broker exploded"}
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(HavePrefix("service MyCache exists, but its last operation failed: broker exploded"))
+			result, _ := serviceCreatorCmd.Results().Find("MyCache")
+			Expect(result.Status).Should(Equal(ResultFailed))
+
+			// An operation still in progress is waited on, and its failure is reported
+			cache.LastOperation = plugin_models.GetService_LastOperation{Type: "update", State: "in progress"}
+			cache.PendingPolls, cache.PendingFailure = 1, "out of capacity"
+			err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{PollInterval: time.Millisecond})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("out of capacity"))
+		})
+
+		It("should wait for an earlier delete that is still in progress, and then create the service again", func() {
+			fake.Services = append(fake.Services, &FakeService{
+				GUID:          "old-guid",
+				Name:          "MyCache",
+				Type:          "brokered",
+				Offering:      "p-redis",
+				Plan:          "shared",
+				LastOperation: plugin_models.GetService_LastOperation{Type: "delete", State: "in progress"},
+				PendingPolls:  2,
+			})
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyCache", Broker: "p-redis", PlanName: "shared"}}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{PollInterval: time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			cache := fake.Find("MyCache")
+			Expect(cache).ShouldNot(BeNil())
+			Expect(cache.GUID).ShouldNot(Equal("old-guid"))
+			Expect(cache.LastOperation.Type).Should(Equal("create"))
+			result, _ := serviceCreatorCmd.Results().Find("MyCache")
+			Expect(result.Action).Should(Equal(PlanCreate))
+		})
+
+		It("should not create keys for, or share, a service that is skipped for conflicting with its manifest entry", func() {
+			fake.PollsToComplete = 0
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyService", Broker: "p-redis", PlanName: "shared"}}
+			Expect(serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})).Should(Succeed())
+
+			mockServiceManifest.Services = []serviceManifest.Service{{
+				ServiceName: "MyService",
+				Broker:      "p-mysql",
+				PlanName:    "1gb",
+				ServiceKeys: []serviceManifest.ServiceKey{{Name: "k"}},
+				ShareTo:     []string{"o/s"},
+			}}
+			for _, parallel := range []int{0, 2} {
+				err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{WarnOnConflicts: true, Parallel: parallel})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				service := fake.Find("MyService")
+				Expect(service.Offering).Should(Equal("p-redis"))
+				Expect(service.Keys).Should(BeEmpty())
+				Expect(service.Shares).Should(BeEmpty())
+				result, _ := serviceCreatorCmd.Results().Find("MyService")
+				Expect(result.Action).Should(Equal(PlanSkip))
+			}
+		})
+
+		It("should fail with the description of a failed last operation", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyQueue", Broker: "p-rabbitmq", PlanName: "standard",
+				JSONParameters: "{\"fake-failure\":\"out of capacity\"}"}}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{PollInterval: time.Millisecond})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("out of capacity"))
+			Expect(fake.Find("MyQueue").LastOperation.State).Should(Equal("failed"))
+
+			result, _ := serviceCreatorCmd.Results().Find("MyQueue")
+			Expect(result.Status).Should(Equal(ResultFailed))
+		})
+
+		It("should keep going past a failed service", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{
+				{ServiceName: "MyQueue", Broker: "p-rabbitmq", PlanName: "standard", JSONParameters: "{\"fake-failure\":\"out of capacity\"}"},
+				{ServiceName: "MyConfig", Broker: "p-config-server", PlanName: "standard"},
+			}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{KeepGoing: true, PollInterval: time.Millisecond})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("MyQueue"))
+			Expect(fake.Find("MyConfig").LastOperation.State).Should(Equal("succeeded"))
+		})
+
+		It("should fail on a plan that isn't in the marketplace, before creating anything", func() {
+			mockServiceManifest.Services = []serviceManifest.Service{
+				{ServiceName: "MyConfig", Broker: "p-config-server", PlanName: "standard"},
+				{ServiceName: "MyDatabase", Broker: "p-mysql", PlanName: "huge"},
+			}
+
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{CheckMarketplace: true})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("plan huge is not offered by broker p-mysql"))
+			Expect(fake.Services).Should(BeEmpty())
+		})
+
+		It("should create service keys, share services and bind them to apps", func() {
+			fake.PollsToComplete = 0
+			mockServiceManifest.Services = []serviceManifest.Service{{
+				ServiceName: "MyDatabase",
+				Broker:      "p-mysql",
+				PlanName:    "1gb",
+				ServiceKeys: []serviceManifest.ServiceKey{{Name: "reporting"}},
+				ShareTo:     []string{"other-org/other-space"},
+				BindTo:      []string{"myapp"},
+			}}
+
+			Expect(serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})).Should(Succeed())
+			Expect(serviceCreatorCmd.BindServices(mockServiceManifest, mockCFPlugin, Options{})).Should(Succeed())
+
+			database := fake.Find("MyDatabase")
+			Expect(database.Keys).Should(Equal([]string{"reporting"}))
+			Expect(database.Shares).Should(Equal([]string{"other-org/other-space"}))
+			Expect(database.Apps).Should(Equal([]string{"myapp"}))
+		})
+
+		It("should unbind and delete a service that is absent from the manifest, along with its keys and shares", func() {
+			fake.PollsToComplete = 0
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyDatabase", Broker: "p-mysql", PlanName: "1gb", BindTo: []string{"myapp"},
+				ServiceKeys: []serviceManifest.ServiceKey{{Name: "reporting"}}, ShareTo: []string{"other-org/other-space"}}}
+			Expect(serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{})).Should(Succeed())
+			Expect(serviceCreatorCmd.BindServices(mockServiceManifest, mockCFPlugin, Options{})).Should(Succeed())
+
+			mockServiceManifest.Services[0].State = "absent"
+			err := serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{DryRun: true})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fake.Services).Should(HaveLen(1))
+			Expect(fake.Find("MyDatabase").Keys).Should(HaveLen(1))
+			result, found := serviceCreatorCmd.Results().Find("MyDatabase")
+			Expect(found).Should(BeTrue())
+			Expect(result.Action).Should(Equal(PlanDelete))
+
+			err = serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, Options{ConfirmPrune: true})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fake.Services).Should(BeEmpty())
+			result, found = serviceCreatorCmd.Results().Find("MyDatabase")
+			Expect(found).Should(BeTrue())
+			Expect(result.Action).Should(Equal(PlanDelete))
+			Expect(result.Status).Should(Equal(ResultSucceeded))
+		})
+
+		It("should refuse to delete a service that still has keys or shares", func() {
+			fake.Services = append(fake.Services, &FakeService{GUID: "guid-1", Name: "MyDatabase", Type: "credentials", Keys: []string{"reporting"}})
+			Expect(fake.DeleteService("MyDatabase")).Should(MatchError(ContainSubstring("it has service keys reporting")))
+
+			fake.Find("MyDatabase").Keys, fake.Find("MyDatabase").Shares = nil, []string{"other-org/other-space"}
+			Expect(fake.DeleteService("MyDatabase")).Should(MatchError(ContainSubstring("it is shared to other-org/other-space")))
+
+			fake.Find("MyDatabase").Shares = nil
+			Expect(fake.DeleteService("MyDatabase")).Should(Succeed())
+			Expect(fake.Services).Should(BeEmpty())
+		})
+
+		It("should keep the fake foundation in a state file between runs", func() {
+			stateDir, err := ioutil.TempDir("", "csp-fake")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(stateDir)
+			stateFile := filepath.Join(stateDir, "fake-foundation.json")
+
+			mockServiceManifest.Services = []serviceManifest.Service{{ServiceName: "MyRegistry", Broker: "p-service-registry", PlanName: "standard"}}
+			options := Options{Backend: BackendFake, FakeStateFile: stateFile, PollInterval: time.Millisecond}
+			Expect((&ServiceCreator{}).CreateServices(mockServiceManifest, mockCFPlugin, options)).Should(Succeed())
+
+			reloaded, err := LoadFakeBackend(stateFile)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(reloaded.Find("MyRegistry").LastOperation.State).Should(Equal("succeeded"))
+
+			serviceCreatorCmd = &ServiceCreator{}
+			Expect(serviceCreatorCmd.CreateServices(mockServiceManifest, mockCFPlugin, options)).Should(Succeed())
+			result, _ := serviceCreatorCmd.Results().Find("MyRegistry")
+			Expect(result.Action).Should(Equal(PlanSkip))
+		})
+	})
 })
@@ -0,0 +1,81 @@
+package serviceCreator
+
+import (
+	"fmt"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// createServiceKeys creates the keys of a service that do not exist yet. Existing keys are recreated
+// when both the key has recreate set and the service has updateService set.
+func (c *ServiceCreator) createServiceKeys(serviceObject serviceManifest.Service) error {
+	if len(serviceObject.ServiceKeys) == 0 {
+		return nil
+	}
+
+	name := serviceObject.ServiceName
+	existingKeys, err := c.getServiceKeyNames(name)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range serviceObject.ServiceKeys {
+		planName := fmt.Sprintf("%s/%s", name, key.Name)
+		fmt.Printf("%s - service key %s ", name, key.Name)
+
+		if existingKeys[key.Name] {
+			if !serviceObject.UpdateService || !key.Recreate {
+				fmt.Print("already exists...skipping creation\n")
+				c.plan.Add(planName, PlanSkip, nil)
+				continue
+			}
+
+			fmt.Print("will now be recreated.\n")
+			err = c.execute(planName, PlanUpdate, deleteServiceKeyCommand(name, key.Name), func() error {
+				return c.backend.DeleteServiceKey(name, key.Name)
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			fmt.Print("will now be created.\n")
+		}
+
+		action := PlanCreate
+		if existingKeys[key.Name] {
+			action = PlanUpdate
+		}
+		err = c.execute(planName, action, createServiceKeyCommand(name, key.Name, key.JSONParameters), func() error {
+			return c.backend.CreateServiceKey(name, key.Name, key.JSONParameters)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getServiceKeyNames returns the set of key names that exist for a service.
+// A service that does not exist yet, e.g., on a dry run, has no keys.
+func (c *ServiceCreator) getServiceKeyNames(name string) (map[string]bool, error) {
+	keyNames := map[string]bool{}
+
+	existing, _, err := c.inventory.Find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	guid := existing.Guid
+	if guid == "" {
+		return keyNames, nil
+	}
+
+	err = c.withRetries(name, "cf service-keys", func() error {
+		keyNames, err = c.backend.ListServiceKeys(guid)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the service keys of service %s: %s", name, err)
+	}
+	return keyNames, nil
+}
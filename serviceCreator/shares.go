@@ -0,0 +1,98 @@
+package serviceCreator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dawu415/CF-CLI-Create-Service-Push-Plugin/serviceManifest"
+)
+
+// shareService shares a service into each org/space in share-to that it isn't shared with yet.
+// With unshare-unlisted, the service is also unshared from any org/space that isn't in share-to, including
+// spaces it was shared to by hand, so each unshare is warned about.
+func (c *ServiceCreator) shareService(serviceObject serviceManifest.Service) error {
+	if len(serviceObject.ShareTo) == 0 && !serviceObject.UnshareUnlisted {
+		return nil
+	}
+
+	name := serviceObject.ServiceName
+	existingShares, err := c.getSharedTo(name)
+	if err != nil {
+		return err
+	}
+
+	wantedShares := map[string]bool{}
+	for _, target := range serviceObject.ShareTo {
+		wantedShares[target] = true
+		if existingShares[target] {
+			fmt.Printf("%s - already shared to %s...skipping sharing\n", name, target)
+			continue
+		}
+
+		org, space := splitTarget(target)
+		fmt.Printf("%s - will now be shared to %s.\n", name, target)
+		err = c.execute(fmt.Sprintf("%s/%s", name, target), PlanCreate, shareServiceCommand(name, org, space), func() error {
+			return c.backend.ShareService(name, org, space)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !serviceObject.UnshareUnlisted {
+		return nil
+	}
+
+	unlistedShares := []string{}
+	for target := range existingShares {
+		if !wantedShares[target] {
+			unlistedShares = append(unlistedShares, target)
+		}
+	}
+	sort.Strings(unlistedShares)
+
+	for _, target := range unlistedShares {
+		org, space := splitTarget(target)
+		fmt.Printf("%s - WARNING: %s is not listed in share-to, and the service will now be unshared from it, since unshare-unlisted is set. "+
+			"Apps in %s lose access to the service, even if it was shared there by hand\n", name, target, target)
+		err = c.execute(fmt.Sprintf("%s/%s", name, target), PlanDelete, unshareServiceCommand(name, org, space), func() error {
+			return c.backend.UnshareService(name, org, space)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSharedTo returns the set of org/space targets that a service is shared to.
+// A service that does not exist yet, e.g., on a dry run, is not shared anywhere.
+func (c *ServiceCreator) getSharedTo(name string) (map[string]bool, error) {
+	targets := map[string]bool{}
+
+	existing, _, err := c.inventory.Find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	guid := existing.Guid
+	if guid == "" {
+		return targets, nil
+	}
+
+	err = c.withRetries(name, "reading the spaces it is shared to", func() error {
+		targets, err = c.backend.ListShares(guid)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the spaces that service %s is shared to: %s", name, err)
+	}
+	return targets, nil
+}
+
+// splitTarget splits an org/space target into its org and space
+func splitTarget(target string) (string, string) {
+	parts := strings.SplitN(target, "/", 2)
+	return parts[0], parts[1]
+}
@@ -0,0 +1,733 @@
+package serviceCreator
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// v3PerPage is the largest page of resources the Cloud Controller returns
+const v3PerPage = "5000"
+
+// v3Backend calls the Cloud Controller v3 API directly, with the API endpoint and access token of the cf CLI.
+// It works with foundations that have the v2 API disabled, and does not depend on the v6 commands of the cf CLI.
+// Keys, shares and bindings are still made with cf CLI commands, which cf7 and cf8 carry out with the v3 API.
+type v3Backend struct {
+	*cliBackend
+	endpoint  string
+	spaceGUID string
+	http      *http.Client
+	jobs      map[string]string // The URL of the job of each service whose asynchronous operation is being waited on, by name
+}
+
+// newV3Backend creates a backend for the API endpoint and space that the cf CLI targets
+func newV3Backend(cf plugin.CliConnection) (*v3Backend, error) {
+	endpoint, err := cf.ApiEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("no API endpoint is set. Use 'cf api' and 'cf login' before using the v3 backend")
+	}
+
+	space, err := cf.GetCurrentSpace()
+	if err != nil {
+		return nil, err
+	}
+	if space.Guid == "" {
+		return nil, fmt.Errorf("no space is targeted. Use 'cf target -s' before using the v3 backend")
+	}
+
+	sslDisabled, err := cf.IsSSLDisabled()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v3Backend{
+		cliBackend: newCLIBackend(cf),
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		spaceGUID:  space.Guid,
+		http: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: sslDisabled}},
+		},
+		jobs: map[string]string{},
+	}, nil
+}
+
+// v3Error is the error for a Cloud Controller request that failed. Its status code and the titles of its errors,
+// e.g., CF-AsyncServiceInstanceOperationInProgress, tell transient failures apart from permanent ones.
+type v3Error struct {
+	method     string
+	path       string
+	status     string
+	statusCode int
+	titles     []string
+	detail     string
+}
+
+func (e *v3Error) Error() string {
+	return fmt.Sprintf("%s %s failed with %s: %s", e.method, e.path, e.status, e.detail)
+}
+
+// request sends a request to the Cloud Controller and decodes its JSON response, if there is one, into response.
+// path is either relative to the API endpoint or, as for jobs and further pages, a full URL. It returns the
+// Location header, which holds the job of an asynchronous operation.
+func (v *v3Backend) request(method, path string, body interface{}, response interface{}) (string, error) {
+	requestURL := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		requestURL = v.endpoint + path
+	}
+
+	var requestBody []byte
+	if body != nil {
+		var err error
+		if requestBody, err = json.Marshal(body); err != nil {
+			return "", err
+		}
+	}
+
+	request, err := http.NewRequest(method, requestURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return "", err
+	}
+
+	// The cf CLI refreshes the access token whenever it has expired
+	token, err := v.cf.AccessToken()
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", token)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResponse, err := v.http.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if httpResponse.StatusCode >= 300 {
+		return "", &v3Error{
+			method:     method,
+			path:       path,
+			status:     httpResponse.Status,
+			statusCode: httpResponse.StatusCode,
+			titles:     errorTitles(responseBody),
+			detail:     errorDetail(responseBody),
+		}
+	}
+
+	if response != nil && len(responseBody) > 0 {
+		if err = json.Unmarshal(responseBody, response); err != nil {
+			return "", fmt.Errorf("unable to read the response of %s %s: %s", method, path, err)
+		}
+	}
+	return httpResponse.Header.Get("Location"), nil
+}
+
+// errorDetail returns the details of the errors in a Cloud Controller error response, or the response itself if it has none
+func errorDetail(responseBody []byte) string {
+	var response struct {
+		Errors []struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err == nil && len(response.Errors) > 0 {
+		details := []string{}
+		for _, e := range response.Errors {
+			details = append(details, e.Detail)
+		}
+		return strings.Join(details, "; ")
+	}
+	return strings.TrimSpace(string(responseBody))
+}
+
+// errorTitles returns the titles of the errors in a Cloud Controller error response, e.g., CF-ServiceInstanceNotFound
+func errorTitles(responseBody []byte) []string {
+	var response struct {
+		Errors []struct {
+			Title string `json:"title"`
+		} `json:"errors"`
+	}
+	titles := []string{}
+	if err := json.Unmarshal(responseBody, &response); err == nil {
+		for _, e := range response.Errors {
+			titles = append(titles, e.Title)
+		}
+	}
+	return titles
+}
+
+// list gets every page of a collection, passing each page to read
+func (v *v3Backend) list(path string, read func(page []byte) error) error {
+	for path != "" {
+		var page json.RawMessage
+		if _, err := v.request("GET", path, nil, &page); err != nil {
+			return err
+		}
+		if err := read(page); err != nil {
+			return err
+		}
+
+		var pagination struct {
+			Pagination struct {
+				Next *struct {
+					Href string `json:"href"`
+				} `json:"next"`
+			} `json:"pagination"`
+		}
+		if err := json.Unmarshal(page, &pagination); err != nil {
+			return err
+		}
+
+		path = ""
+		if pagination.Pagination.Next != nil {
+			path = pagination.Pagination.Next.Href
+		}
+	}
+	return nil
+}
+
+// v3Resource is the part of a Cloud Controller resource, or one of its relationships, that identifies it
+type v3Resource struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type v3Relationship struct {
+	Data v3Resource `json:"data"`
+}
+
+// v3ServiceInstance is a service instance, along with the names of its plan and offering
+type v3ServiceInstance struct {
+	v3Resource
+	Type          string   `json:"type"` // managed or user-provided
+	Tags          []string `json:"tags"`
+	LastOperation struct {
+		Type        string `json:"type"`
+		State       string `json:"state"`
+		Description string `json:"description"`
+	} `json:"last_operation"`
+	Relationships struct {
+		ServicePlan v3Relationship `json:"service_plan"`
+	} `json:"relationships"`
+
+	plan     v3Resource
+	offering v3Resource
+}
+
+// instances lists the service instances in the targeted space. filter narrows the list, e.g., &names=db.
+func (v *v3Backend) instances(filter string) ([]v3ServiceInstance, error) {
+	instances := []v3ServiceInstance{}
+	path := "/v3/service_instances?space_guids=" + v.spaceGUID + "&per_page=" + v3PerPage +
+		"&fields[service_plan]=guid,name,relationships.service_offering&fields[service_plan.service_offering]=guid,name" + filter
+
+	err := v.list(path, func(page []byte) error {
+		var response struct {
+			Resources []v3ServiceInstance `json:"resources"`
+			Included  struct {
+				ServicePlans []struct {
+					v3Resource
+					Relationships struct {
+						ServiceOffering v3Relationship `json:"service_offering"`
+					} `json:"relationships"`
+				} `json:"service_plans"`
+				ServiceOfferings []v3Resource `json:"service_offerings"`
+			} `json:"included"`
+		}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return err
+		}
+
+		offerings := map[string]v3Resource{}
+		for _, offering := range response.Included.ServiceOfferings {
+			offerings[offering.GUID] = offering
+		}
+		plans := map[string]v3Resource{}
+		planOfferings := map[string]v3Resource{}
+		for _, plan := range response.Included.ServicePlans {
+			plans[plan.GUID] = plan.v3Resource
+			planOfferings[plan.GUID] = offerings[plan.Relationships.ServiceOffering.Data.GUID]
+		}
+
+		for _, instance := range response.Resources {
+			planGUID := instance.Relationships.ServicePlan.Data.GUID
+			instance.plan = plans[planGUID]
+			instance.offering = planOfferings[planGUID]
+			instances = append(instances, instance)
+		}
+		return nil
+	})
+	return instances, err
+}
+
+// instance returns the named service instance in the targeted space, and whether it exists
+func (v *v3Backend) instance(name string) (v3ServiceInstance, bool, error) {
+	instances, err := v.instances("&names=" + url.QueryEscape(name))
+	if err != nil || len(instances) == 0 {
+		return v3ServiceInstance{}, false, err
+	}
+	return instances[0], true, nil
+}
+
+// ListServices lists the service instances in the targeted space, along with the apps they are bound to
+func (v *v3Backend) ListServices() ([]plugin_models.GetServices_Model, error) {
+	instances, err := v.instances("")
+	if err != nil {
+		return nil, err
+	}
+
+	appNames, err := v.boundApps(instances)
+	if err != nil {
+		return nil, err
+	}
+
+	services := []plugin_models.GetServices_Model{}
+	for _, instance := range instances {
+		services = append(services, plugin_models.GetServices_Model{
+			Guid:             instance.GUID,
+			Name:             instance.Name,
+			ServicePlan:      plugin_models.GetServices_ServicePlan{Guid: instance.plan.GUID, Name: instance.plan.Name},
+			Service:          plugin_models.GetServices_ServiceFields{Name: instance.offering.Name},
+			LastOperation:    plugin_models.GetServices_LastOperation{Type: instance.LastOperation.Type, State: instance.LastOperation.State},
+			ApplicationNames: appNames[instance.GUID],
+			IsUserProvided:   instance.Type == "user-provided",
+		})
+	}
+	return services, nil
+}
+
+// boundApps returns the names of the apps bound to each of the service instances, by instance guid
+func (v *v3Backend) boundApps(instances []v3ServiceInstance) (map[string][]string, error) {
+	appNames := map[string][]string{}
+	if len(instances) == 0 {
+		return appNames, nil
+	}
+
+	guids := []string{}
+	for _, instance := range instances {
+		guids = append(guids, instance.GUID)
+	}
+
+	path := "/v3/service_credential_bindings?type=app&include=app&per_page=" + v3PerPage + "&service_instance_guids=" + strings.Join(guids, ",")
+	err := v.list(path, func(page []byte) error {
+		var response struct {
+			Resources []struct {
+				Relationships struct {
+					App             v3Relationship `json:"app"`
+					ServiceInstance v3Relationship `json:"service_instance"`
+				} `json:"relationships"`
+			} `json:"resources"`
+			Included struct {
+				Apps []v3Resource `json:"apps"`
+			} `json:"included"`
+		}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return err
+		}
+
+		apps := map[string]string{}
+		for _, app := range response.Included.Apps {
+			apps[app.GUID] = app.Name
+		}
+		for _, binding := range response.Resources {
+			instanceGUID := binding.Relationships.ServiceInstance.Data.GUID
+			appNames[instanceGUID] = append(appNames[instanceGUID], apps[binding.Relationships.App.Data.GUID])
+		}
+		return nil
+	})
+	return appNames, err
+}
+
+// GetService gets the named service instance. While the job of an operation started by this client is running,
+// the service is reported as in progress, and once the job has failed, its errors are reported as the failed
+// last operation, even if the broker was never reached.
+func (v *v3Backend) GetService(name string) (plugin_models.GetService_Model, error) {
+	job, err := v.checkJob(name)
+	if err != nil {
+		return plugin_models.GetService_Model{}, err
+	}
+
+	instance, exists, err := v.instance(name)
+	if err != nil {
+		return plugin_models.GetService_Model{}, err
+	}
+	if !exists && job == nil {
+		return plugin_models.GetService_Model{}, fmt.Errorf("Service instance %s not found", name)
+	}
+
+	service := plugin_models.GetService_Model{
+		Guid:            instance.GUID,
+		Name:            name,
+		IsUserProvided:  instance.Type == "user-provided",
+		ServiceOffering: plugin_models.GetService_ServiceFields{Name: instance.offering.Name},
+		ServicePlan:     plugin_models.GetService_ServicePlan{Guid: instance.plan.GUID, Name: instance.plan.Name},
+		LastOperation: plugin_models.GetService_LastOperation{
+			Type:        instance.LastOperation.Type,
+			State:       instance.LastOperation.State,
+			Description: instance.LastOperation.Description,
+		},
+	}
+
+	if job != nil {
+		service.LastOperation.Type = job.operation
+		service.LastOperation.State = job.state
+		if job.state == "failed" || service.LastOperation.Description == "" {
+			service.LastOperation.Description = job.description
+		}
+	}
+	return service, nil
+}
+
+// v3Job is the state of an unfinished or failed job, in the terms of a last operation
+type v3Job struct {
+	operation   string // create, update or delete
+	state       string // in progress or failed
+	description string
+}
+
+// checkJob polls the job of the named service, if it has one. A job that has completed is forgotten and nil is
+// returned, so that the last operation of the service itself is used.
+func (v *v3Backend) checkJob(name string) (*v3Job, error) {
+	jobURL, exists := v.jobs[name]
+	if !exists {
+		return nil, nil
+	}
+
+	var response struct {
+		Operation string `json:"operation"`
+		State     string `json:"state"` // PROCESSING, POLLING, COMPLETE or FAILED
+		Errors    []struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if _, err := v.request("GET", jobURL, nil, &response); err != nil {
+		return nil, err
+	}
+
+	job := &v3Job{
+		operation:   strings.TrimPrefix(response.Operation, "service_instance."),
+		state:       "in progress",
+		description: fmt.Sprintf("job %s", strings.ToLower(response.State)),
+	}
+
+	switch response.State {
+	case "COMPLETE":
+		delete(v.jobs, name)
+		return nil, nil
+	case "FAILED":
+		delete(v.jobs, name)
+		details := []string{}
+		for _, e := range response.Errors {
+			details = append(details, e.Detail)
+		}
+		job.state = "failed"
+		job.description = strings.Join(details, "; ")
+	}
+	return job, nil
+}
+
+// userProvidedFields returns the fields of a user provided service instance in a request
+func userProvidedFields(request ServiceRequest) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	switch request.Type {
+	case "credentials":
+		if !json.Valid([]byte(request.Credentials)) {
+			return nil, fmt.Errorf("the credentials of service %s are not valid JSON", request.Name)
+		}
+		fields["credentials"] = json.RawMessage(request.Credentials)
+	case "route":
+		fields["route_service_url"] = request.URL
+	case "drain":
+		fields["syslog_drain_url"] = request.URL
+	}
+	if request.Tags != "" {
+		fields["tags"] = splitTags(request.Tags)
+	}
+	return fields, nil
+}
+
+// managedFields returns the fields of a managed service instance in a request, other than its plan
+func managedFields(request ServiceRequest) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if request.Parameters != "" {
+		if !json.Valid([]byte(request.Parameters)) {
+			return nil, fmt.Errorf("the parameters of service %s are not valid JSON", request.Name)
+		}
+		fields["parameters"] = json.RawMessage(request.Parameters)
+	}
+	if request.Tags != "" {
+		fields["tags"] = splitTags(request.Tags)
+	}
+	return fields, nil
+}
+
+// splitTags splits a comma separated list of tags
+func splitTags(tags string) []string {
+	tagList := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tagList = append(tagList, tag)
+		}
+	}
+	return tagList
+}
+
+func (v *v3Backend) relationship(guid string) map[string]interface{} {
+	return map[string]interface{}{"data": map[string]string{"guid": guid}}
+}
+
+// CreateService creates a service instance. A brokered service is created asynchronously, and its job is tracked.
+func (v *v3Backend) CreateService(request ServiceRequest) error {
+	var body map[string]interface{}
+	var err error
+	if request.isUserProvided() {
+		body, err = userProvidedFields(request)
+		if err != nil {
+			return err
+		}
+		body["type"] = "user-provided"
+		body["relationships"] = map[string]interface{}{"space": v.relationship(v.spaceGUID)}
+	} else {
+		body, err = managedFields(request)
+		if err != nil {
+			return err
+		}
+
+		planGUID, err := v.planGUID(request.Plan, "&service_offering_names="+url.QueryEscape(request.Broker), request.Broker)
+		if err != nil {
+			return err
+		}
+		body["type"] = "managed"
+		body["relationships"] = map[string]interface{}{
+			"space":        v.relationship(v.spaceGUID),
+			"service_plan": v.relationship(planGUID),
+		}
+	}
+	body["name"] = request.Name
+
+	fmt.Printf("Now Running v3 API Request: POST /v3/service_instances for service %s\n", request.Name)
+	jobURL, err := v.request("POST", "/v3/service_instances", body, nil)
+	v.trackJob(request.Name, jobURL)
+	return err
+}
+
+// UpdateService updates a service instance. A brokered service is updated asynchronously, and its job is tracked.
+func (v *v3Backend) UpdateService(request ServiceRequest) error {
+	instance, exists, err := v.instance(request.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("Service instance %s not found", request.Name)
+	}
+
+	var body map[string]interface{}
+	if request.isUserProvided() {
+		body, err = userProvidedFields(request)
+	} else {
+		body, err = managedFields(request)
+	}
+	if err != nil {
+		return err
+	}
+
+	if request.Plan != "" && !request.isUserProvided() {
+		planGUID, err := v.planGUID(request.Plan, "&service_offering_guids="+instance.offering.GUID, instance.offering.Name)
+		if err != nil {
+			return err
+		}
+		body["relationships"] = map[string]interface{}{"service_plan": v.relationship(planGUID)}
+	}
+
+	fmt.Printf("Now Running v3 API Request: PATCH /v3/service_instances/%s for service %s\n", instance.GUID, request.Name)
+	jobURL, err := v.request("PATCH", "/v3/service_instances/"+instance.GUID, body, nil)
+	v.trackJob(request.Name, jobURL)
+	return err
+}
+
+// DeleteService deletes a service instance. A brokered service is deleted asynchronously, and its job is tracked.
+func (v *v3Backend) DeleteService(name string) error {
+	// Like cf delete-service, deleting a service that doesn't exist succeeds
+	instance, exists, err := v.instance(name)
+	if err != nil || !exists {
+		return err
+	}
+
+	fmt.Printf("Now Running v3 API Request: DELETE /v3/service_instances/%s for service %s\n", instance.GUID, name)
+	jobURL, err := v.request("DELETE", "/v3/service_instances/"+instance.GUID, nil, nil)
+	v.trackJob(name, jobURL)
+	return err
+}
+
+// trackJob remembers the job of an asynchronous operation on a service, so that it is polled along with the service
+func (v *v3Backend) trackJob(name, jobURL string) {
+	if jobURL != "" {
+		v.jobs[name] = jobURL
+	}
+}
+
+// planGUID looks up the guid of a plan visible in the targeted space. filter narrows the plans to those of a service offering.
+func (v *v3Backend) planGUID(plan, filter, offering string) (string, error) {
+	guids := []string{}
+	path := "/v3/service_plans?space_guids=" + v.spaceGUID + "&names=" + url.QueryEscape(plan) + filter
+	err := v.list(path, func(page []byte) error {
+		var response struct {
+			Resources []v3Resource `json:"resources"`
+		}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return err
+		}
+		for _, resource := range response.Resources {
+			guids = append(guids, resource.GUID)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(guids) == 0 {
+		return "", fmt.Errorf("plan %s of service offering %s was not found in the targeted space", plan, offering)
+	} else if len(guids) > 1 {
+		return "", fmt.Errorf("plan %s of service offering %s is offered by more than one service broker", plan, offering)
+	}
+	return guids[0], nil
+}
+
+// GetServiceTags returns the tags of a service instance
+func (v *v3Backend) GetServiceTags(service plugin_models.GetServices_Model) ([]string, error) {
+	var instance v3ServiceInstance
+	_, err := v.request("GET", "/v3/service_instances/"+service.Guid, nil, &instance)
+	return instance.Tags, err
+}
+
+// GetServiceLabels returns the metadata labels of a service instance
+func (v *v3Backend) GetServiceLabels(guid string) (map[string]string, error) {
+	var instance struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	_, err := v.request("GET", "/v3/service_instances/"+guid, nil, &instance)
+	return instance.Metadata.Labels, err
+}
+
+// GetServiceCredentials returns the credentials of a user provided service
+func (v *v3Backend) GetServiceCredentials(guid string) (map[string]interface{}, error) {
+	credentials := map[string]interface{}{}
+	_, err := v.request("GET", "/v3/service_instances/"+guid+"/credentials", nil, &credentials)
+	return credentials, err
+}
+
+// SetServiceMetadata adds to, or changes, the metadata labels and annotations of a service instance
+func (v *v3Backend) SetServiceMetadata(guid string, labels, annotations map[string]string) error {
+	body, err := metadataBody(labels, annotations)
+	if err != nil {
+		return err
+	}
+	_, err = v.request("PATCH", "/v3/service_instances/"+guid, json.RawMessage(body), nil)
+	return err
+}
+
+// ListServiceKeys returns the set of key names of a service instance
+func (v *v3Backend) ListServiceKeys(guid string) (map[string]bool, error) {
+	keyNames := map[string]bool{}
+	err := v.list("/v3/service_credential_bindings?type=key&per_page="+v3PerPage+"&service_instance_guids="+guid, func(page []byte) error {
+		var response struct {
+			Resources []v3Resource `json:"resources"`
+		}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return err
+		}
+		for _, resource := range response.Resources {
+			keyNames[resource.Name] = true
+		}
+		return nil
+	})
+	return keyNames, err
+}
+
+// ListShares returns the set of org/space targets that a service instance is shared to
+func (v *v3Backend) ListShares(guid string) (map[string]bool, error) {
+	var response struct {
+		Data     []v3Resource `json:"data"`
+		Included struct {
+			Spaces []struct {
+				v3Resource
+				Relationships struct {
+					Organization v3Relationship `json:"organization"`
+				} `json:"relationships"`
+			} `json:"spaces"`
+			Organizations []v3Resource `json:"organizations"`
+		} `json:"included"`
+	}
+	path := "/v3/service_instances/" + guid + "/relationships/shared_spaces?fields[space]=guid,name,relationships.organization&fields[space.organization]=guid,name"
+	if _, err := v.request("GET", path, nil, &response); err != nil {
+		return nil, err
+	}
+
+	orgs := map[string]string{}
+	for _, org := range response.Included.Organizations {
+		orgs[org.GUID] = org.Name
+	}
+
+	targets := map[string]bool{}
+	for _, space := range response.Included.Spaces {
+		targets[orgs[space.Relationships.Organization.Data.GUID]+"/"+space.Name] = true
+	}
+	return targets, nil
+}
+
+// GetMarketplace returns the plans of each service offering, by name, that is visible in the targeted space.
+// Every plan is read at once, so the offerings aren't needed.
+func (v *v3Backend) GetMarketplace(offerings []string) (map[string]map[string]bool, error) {
+	marketplace := map[string]map[string]bool{}
+	err := v.list("/v3/service_plans?include=service_offering&per_page="+v3PerPage+"&space_guids="+v.spaceGUID, func(page []byte) error {
+		var response struct {
+			Resources []struct {
+				v3Resource
+				Relationships struct {
+					ServiceOffering v3Relationship `json:"service_offering"`
+				} `json:"relationships"`
+			} `json:"resources"`
+			Included struct {
+				ServiceOfferings []v3Resource `json:"service_offerings"`
+			} `json:"included"`
+		}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return err
+		}
+
+		names := map[string]string{}
+		for _, offering := range response.Included.ServiceOfferings {
+			names[offering.GUID] = offering.Name
+		}
+		for _, plan := range response.Resources {
+			offering := names[plan.Relationships.ServiceOffering.Data.GUID]
+			if marketplace[offering] == nil {
+				marketplace[offering] = map[string]bool{}
+			}
+			marketplace[offering][plan.Name] = true
+		}
+		return nil
+	})
+	return marketplace, err
+}
@@ -0,0 +1,73 @@
+package serviceManifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortByDependencies returns the services ordered such that every service comes after the services
+// listed in its depends-on field. Services that do not depend on each other keep their manifest order.
+// An error is returned if a service depends on one that is not in the manifest, or if there is a cycle.
+func (m *ServiceManifest) SortByDependencies() ([]Service, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	servicesByName := map[string]Service{}
+	for _, service := range m.Services {
+		servicesByName[service.ServiceName] = service
+	}
+
+	state := map[string]int{}
+	sorted := []Service{}
+	path := []string{}
+
+	var visit func(service Service) error
+	visit = func(service Service) error {
+		switch state[service.ServiceName] {
+		case visited:
+			return nil
+		case visiting:
+			// Report the cycle starting from the first time we saw this service
+			for idx, name := range path {
+				if name == service.ServiceName {
+					return fmt.Errorf("Dependency cycle detected between services: %s",
+						strings.Join(append(path[idx:], service.ServiceName), " -> "))
+				}
+			}
+		}
+
+		state[service.ServiceName] = visiting
+		path = append(path, service.ServiceName)
+
+		for _, dependencyName := range service.DependsOn {
+			dependency, exists := servicesByName[dependencyName]
+			if !exists {
+				return fmt.Errorf("Service %s depends on %s, which is not in the services manifest", service.ServiceName, dependencyName)
+			}
+
+			if dependency.State == "absent" && service.State != "absent" {
+				return fmt.Errorf("Service %s depends on %s, which is marked absent", service.ServiceName, dependencyName)
+			}
+
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[service.ServiceName] = visited
+		sorted = append(sorted, service)
+		return nil
+	}
+
+	for _, service := range m.Services {
+		if err := visit(service); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
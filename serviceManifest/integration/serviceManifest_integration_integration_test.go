@@ -1,6 +1,9 @@
 package serviceManifest_integration_test
 
 import (
+	"encoding/json"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -71,7 +74,7 @@ var _ = Describe("ServiceManifest", func() {
 		Expect(manifest.Services[0].ServiceName).Should(Equal("my-database-service"))
 		Expect(manifest.Services[0].Broker).Should(Equal("p-mysql"))
 		Expect(manifest.Services[0].PlanName).Should(Equal("1gb"))
-		Expect(manifest.Services[0].JSONParameters).Should(Equal("{\"RAM\": 4gb }"))
+		Expect(manifest.Services[0].JSONParameters).Should(Equal("{\"RAM\": \"4gb\" }"))
 		Expect(manifest.Services[0].Tags).Should(Equal("test1, test2"))
 		Expect(manifest.Services[0].UpdateService).Should(BeTrue())
 	})
@@ -90,9 +93,9 @@ var _ = Describe("ServiceManifest", func() {
 
 		Expect(manifest.Services[0].Type).Should(Equal("credentials"))
 		Expect(manifest.Services[0].ServiceName).Should(Equal("CUPS"))
-		Expect(manifest.Services[0].Credentials["host"]).Should(Equal("https://abc.mydatabase.com/abcd"))
-		Expect(manifest.Services[0].Credentials["username"]).Should(Equal("david"))
-		Expect(manifest.Services[0].Credentials["password"]).Should(Equal("12.23@123password"))
+		Expect(manifest.Services[0].Credentials).Should(HaveKeyWithValue("host", "https://abc.mydatabase.com/abcd"))
+		Expect(manifest.Services[0].Credentials).Should(HaveKeyWithValue("username", "david"))
+		Expect(manifest.Services[0].Credentials).Should(HaveKeyWithValue("password", "12.23@123password"))
 		Expect(manifest.Services[0].UpdateService).Should(BeFalse())
 	})
 
@@ -242,4 +245,111 @@ var _ = Describe("ServiceManifest", func() {
 		Expect(manifest.Services[0].Credentials).Should(HaveKeyWithValue("host", "https://sandbox.mydatabase.com/apps/test"))
 	})
 
+	It("A parser can open a valid yml with service dependencies", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-valid-dependencies.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		manifest, err := p.Parse([]string{}, map[string]string{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(manifest.Services[0].DependsOn).Should(Equal([]string{"my-configserver"}))
+
+		sorted, err := manifest.SortByDependencies()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sorted[0].ServiceName).Should(Equal("my-configserver"))
+		Expect(sorted[1].ServiceName).Should(Equal("Credentials-UPS"))
+	})
+
+	It("A parser should fail on a yml with a dependency cycle", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-invalid-dependency-cycle.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		_, err = p.Parse([]string{}, map[string]string{})
+		Expect(err).Should(MatchError("Dependency cycle detected between services: my-configserver -> Credentials-UPS -> my-configserver"))
+	})
+
+	It("A parser can open a valid yml broker service definition with service keys", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-valid-service-keys.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		manifest, err := p.Parse([]string{}, map[string]string{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(manifest.Services[0].ServiceKeys).Should(Equal([]ServiceKey{
+			{Name: "dashboard-key"},
+			{Name: "migration-key", Parameters: "{\"role\": \"admin\"}", JSONParameters: "{\"role\": \"admin\"}", Recreate: true},
+		}))
+	})
+
+	It("A parser should fail on a share-to target that isn't of the form org/space", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-invalid-share-to.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		_, err = p.Parse([]string{}, map[string]string{})
+		Expect(err).Should(MatchError("The services manifest ./fixtures/service-manifest-invalid-share-to.yml is invalid:\n" +
+			"  ./fixtures/service-manifest-invalid-share-to.yml:6:3: service my-messaging-service has a share-to target \"team-a-dev\". Targets must be of the form org/space"))
+	})
+
+	It("A parser can convert YAML parameters and parameters files, relative to the manifest rather than the working directory, to JSON", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-valid-yaml-parameters.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		manifest, err := p.Parse([]string{}, map[string]string{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(manifest.Services[0].JSONParameters).Should(MatchJSON(
+			"{\"RAM\":\"4gb\",\"replicas\":3,\"backups\":{\"enabled\":true,\"schedule\":[\"daily\",\"weekly\"]}}"))
+		Expect(manifest.Services[1].JSONParameters).Should(MatchJSON(
+			"{\"maxmemory-policy\":\"allkeys-lru\",\"persistence\":false}"))
+	})
+
+	It("should accept tags as either a list or a comma separated string", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-valid-tags.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		manifest, err := p.Parse([]string{}, map[string]string{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(manifest.Services[0].Tags).Should(Equal("mysql, relational"))
+		Expect(manifest.Services[1].Tags).Should(Equal("config, shared"))
+	})
+
+	It("should convert structured credentials and a credentials-file into JSON compatible values", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-valid-structured-credentials.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		manifest, err := p.Parse([]string{}, map[string]string{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		credentialsJSON, err := json.Marshal(manifest.Services[0].Credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(credentialsJSON).Should(MatchJSON(
+			"{\"uri\":\"https://config.example.com\",\"port\":8443,\"ssl\":true,\"profiles\":[\"cloud\",\"production\"],\"client\":{\"id\":\"my-app\",\"scopes\":[\"read\",\"write\"]}}"))
+
+		credentialsJSON, err = json.Marshal(manifest.Services[1].Credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(credentialsJSON).Should(MatchJSON("{\"uri\":\"https://db.example.com\",\"replicas\":3}"))
+	})
+
+	It("A parser should fail on an unsupported onFailure policy", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-invalid-on-failure.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		_, err = p.Parse([]string{}, map[string]string{})
+		Expect(err).Should(MatchError("The services manifest ./fixtures/service-manifest-invalid-on-failure.yml is invalid:\n" +
+			"  ./fixtures/service-manifest-invalid-on-failure.yml:6:3: service my-database-service has an unsupported onFailure \"retry\". Use fail, recreate, ignore"))
+	})
+
+	It("A parser reports every schema problem in a manifest along with its line and column", func() {
+		p, err := realParser.CreateParser("./fixtures/service-manifest-invalid-schema.yml")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		_, err = p.Parse([]string{}, map[string]string{})
+		Expect(err).Should(MatchError(strings.Join([]string{
+			"The services manifest ./fixtures/service-manifest-invalid-schema.yml is invalid:",
+			"  ./fixtures/service-manifest-invalid-schema.yml:3:3: service my-database-service is a brokered service, but is missing plan",
+			"  ./fixtures/service-manifest-invalid-schema.yml:5:3: unknown key \"plna\" in service my-database-service. Did you mean \"plan\"?",
+			"  ./fixtures/service-manifest-invalid-schema.yml:6:3: unknown key \"updateservice\" in service my-database-service. Did you mean \"updateService\"?",
+			"  ./fixtures/service-manifest-invalid-schema.yml:10:3: service my-route-service is a route service, but its url \"http://www.example.com\" does not use https",
+			"  ./fixtures/service-manifest-invalid-schema.yml:12:3: service name my-database-service is used more than once. It was first used on line 3",
+			"  ./fixtures/service-manifest-invalid-schema.yml:13:3: service my-database-service has an unsupported type \"credential\". Use brokered, credentials, drain, route",
+			"  ./fixtures/service-manifest-invalid-schema.yml:18:3: retries of service my-cache-service must be a whole number",
+		}, "\n")))
+	})
 })
@@ -0,0 +1,57 @@
+package serviceManifest
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// resolveJSON converts a value that may be either a JSON string or YAML into a JSON string. A string is passed on
+// as it is, for backwards compatibility, but only if it is valid JSON. The description names the value in errors.
+func resolveJSON(description string, value interface{}) (string, error) {
+	switch typedValue := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(typedValue), &decoded); typedValue != "" && err != nil {
+			return "", fmt.Errorf("The %s are not valid JSON: %s", description, err)
+		}
+		return typedValue, nil
+	default:
+		jsonValue, err := toJSON(typedValue)
+		if err != nil {
+			return "", fmt.Errorf("Unable to convert the %s to JSON: %s", description, err)
+		}
+		return jsonValue, nil
+	}
+}
+
+// toJSON converts a value decoded by yaml.v2 into a JSON string
+func toJSON(value interface{}) (string, error) {
+	bytes, err := json.Marshal(jsonCompatible(value))
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values that yaml.v2 decodes maps into,
+// which encoding/json cannot marshal, into map[string]interface{} values.
+func jsonCompatible(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, element := range typedValue {
+			converted[fmt.Sprintf("%v", key)] = jsonCompatible(element)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(typedValue))
+		for idx, element := range typedValue {
+			converted[idx] = jsonCompatible(element)
+		}
+		return converted
+	default:
+		return value
+	}
+}
@@ -1,16 +1,173 @@
 package serviceManifest
 
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
 // Service describes a CF service that will be instantiated
 type Service struct {
-	ServiceName    string            `yaml:"name"`
-	Type           string            `yaml:"type"` //brokered, credentials, drain, route.  "blank" == brokered
-	Broker         string            `yaml:"broker"`
-	PlanName       string            `yaml:"plan"`
-	URL            string            `yaml:"url"`
-	UpdateService  bool              `yaml:"updateService"` // Does not update service plan. This should be done manually.
-	Credentials    map[string]string `yaml:"credentials"`
-	Tags           string            `yaml:"tags"`
-	JSONParameters string            `yaml:"parameters"`
+	ServiceName          string            `yaml:"name"`
+	Type                 string            `yaml:"type"`  //brokered, credentials, drain, route.  "blank" == brokered
+	State                string            `yaml:"state"` //present, absent.  "blank" == present
+	Broker               string            `yaml:"broker"`
+	PlanName             string            `yaml:"plan"`
+	URL                  string            `yaml:"url"`
+	OnFailure            string            `yaml:"onFailure"`        // fail, recreate, ignore.  "blank" == fail
+	UpdateService        bool              `yaml:"updateService"`    // Does not update service plan, unless AllowPlanChange is set.
+	AllowPlanChange      bool              `yaml:"allowPlanChange"`  // Allow the plan of an existing brokered service to be changed to PlanName
+	Credentials          interface{}       `yaml:"credentials"`      // Any YAML, which is converted to the JSON credentials of a credentials service
+	CredentialsFile      string            `yaml:"credentials-file"` // A JSON or YAML file that is read into Credentials
+	TagList              interface{}       `yaml:"tags"`             // A list of tags or a comma separated string of tags
+	Tags                 string            `yaml:"-"`                // Comma separated tags
+	Parameters           interface{}       `yaml:"parameters"`       // A JSON string, or YAML that is converted to JSONParameters
+	ParametersFile       string            `yaml:"parameters-file"`  // A JSON or YAML file that is converted to JSONParameters
+	JSONParameters       string            `yaml:"-"`
+	DependsOn            []string          `yaml:"depends-on"`         // Names of services in this manifest that must be created first
+	Timeout              string            `yaml:"timeout"`            // How long to wait for the service's last operation, e.g., 30m. Blank uses the global setting.
+	PollInterval         string            `yaml:"pollInterval"`       // Initial time between polls of the service's last operation, e.g., 10s. Blank uses the global setting.
+	Retries              int               `yaml:"retries"`            // How many times a cf call for the service is retried on a retryable error. 0 uses the global setting.
+	ServiceKeys          []ServiceKey      `yaml:"service-keys"`       // Keys created once a brokered service has succeeded
+	BindTo               []string          `yaml:"bind-to"`            // Names of apps to bind the service to, once they have been pushed
+	RawBindingParameters interface{}       `yaml:"binding-parameters"` // A JSON string, or YAML that is converted to BindingParameters
+	BindingParameters    string            `yaml:"-"`                  // JSON parameters passed to each binding
+	ShareTo              []string          `yaml:"share-to"`           // org/space targets the brokered service is shared into
+	UnshareUnlisted      bool              `yaml:"unshare-unlisted"`   // Unshare the service from any org/space not in ShareTo
+	Labels               map[string]string `yaml:"labels"`             // Metadata labels set on the service instance when it is created or updated
+	Annotations          map[string]string `yaml:"annotations"`        // Metadata annotations set on the service instance when it is created or updated
+}
+
+// ServiceKey describes a service key of a brokered service
+type ServiceKey struct {
+	Name           string      `yaml:"name"`
+	Parameters     interface{} `yaml:"parameters"` // A JSON string, or YAML that is converted to JSONParameters
+	JSONParameters string      `yaml:"-"`
+	Recreate       bool        `yaml:"recreate"` // Delete and create the key again when the service has updateService set
+}
+
+// TimeoutDuration returns the service timeout as a duration. A blank timeout returns 0.
+func (s Service) TimeoutDuration() (time.Duration, error) {
+	return parseDuration(s.ServiceName, "timeout", s.Timeout)
+}
+
+// PollIntervalDuration returns the service poll interval as a duration. A blank poll interval returns 0.
+func (s Service) PollIntervalDuration() (time.Duration, error) {
+	return parseDuration(s.ServiceName, "pollInterval", s.PollInterval)
+}
+
+// ResolveParameters sets JSONParameters from the parameters field, which may be either a JSON string or YAML,
+// or from the file given by the parameters-file field, relative to manifestDir. Only one of the two may be specified.
+// The parameters of the service keys, and of the bindings, of the service are resolved in the same way, except from
+// a file. Parameters that are not valid JSON are caught here, before any service is created.
+func (s *Service) ResolveParameters(manifestDir string) error {
+	if s.Parameters != nil && s.ParametersFile != "" {
+		return fmt.Errorf("Service %s has both parameters and parameters-file. Only one may be specified", s.ServiceName)
+	}
+
+	parameters := s.Parameters
+	if s.ParametersFile != "" {
+		rawParametersFile, err := ioutil.ReadFile(relativeTo(manifestDir, s.ParametersFile))
+		if err != nil {
+			return fmt.Errorf("Unable to read the parameters-file of service %s: %s", s.ServiceName, err)
+		}
+
+		// JSON is also valid YAML, so the file can be in either format
+		if err = yaml.Unmarshal(rawParametersFile, &parameters); err != nil {
+			return fmt.Errorf("Invalid parameters-file %s of service %s: %s", s.ParametersFile, s.ServiceName, err)
+		}
+	}
+
+	var err error
+	if s.JSONParameters, err = resolveJSON("parameters of service "+s.ServiceName, parameters); err != nil {
+		return err
+	}
+	if s.BindingParameters, err = resolveJSON("binding-parameters of service "+s.ServiceName, s.RawBindingParameters); err != nil {
+		return err
+	}
+
+	for idx := range s.ServiceKeys {
+		key := &s.ServiceKeys[idx]
+		description := fmt.Sprintf("parameters of service key %s of service %s", key.Name, s.ServiceName)
+		if key.JSONParameters, err = resolveJSON(description, key.Parameters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveCredentials reads Credentials from the file given by the credentials-file field, relative to manifestDir,
+// if any, and converts them into values that can be marshalled to JSON. Only one of credentials and credentials-file
+// may be specified.
+func (s *Service) ResolveCredentials(manifestDir string) error {
+	if s.Credentials != nil && s.CredentialsFile != "" {
+		return fmt.Errorf("Service %s has both credentials and credentials-file. Only one may be specified", s.ServiceName)
+	}
+
+	if s.CredentialsFile != "" {
+		rawCredentialsFile, err := ioutil.ReadFile(relativeTo(manifestDir, s.CredentialsFile))
+		if err != nil {
+			return fmt.Errorf("Unable to read the credentials-file of service %s: %s", s.ServiceName, err)
+		}
+
+		// JSON is also valid YAML, so the file can be in either format
+		if err = yaml.Unmarshal(rawCredentialsFile, &s.Credentials); err != nil {
+			return fmt.Errorf("Invalid credentials-file %s of service %s: %s", s.CredentialsFile, s.ServiceName, err)
+		}
+	}
+
+	switch s.Credentials.(type) {
+	case nil, map[interface{}]interface{}:
+		s.Credentials = jsonCompatible(s.Credentials)
+	default:
+		return fmt.Errorf("Service %s has credentials that are not a map of names to values", s.ServiceName)
+	}
+	return nil
+}
+
+// ResolveTags sets Tags from the tags field, which may be either a list or a comma separated string
+func (s *Service) ResolveTags() error {
+	switch typedTags := s.TagList.(type) {
+	case nil:
+		s.Tags = ""
+	case string:
+		s.Tags = typedTags
+	case []interface{}:
+		tags := []string{}
+		for _, tag := range typedTags {
+			tags = append(tags, fmt.Sprintf("%v", tag))
+		}
+		s.Tags = strings.Join(tags, ", ")
+	default:
+		return fmt.Errorf("Service %s has tags that are neither a list nor a comma separated string", s.ServiceName)
+	}
+	return nil
+}
+
+// relativeTo returns the path of a file named in the services manifest. A relative path is relative to the directory
+// of the services manifest, so that the manifest works from any working directory. A blank directory is the working
+// directory.
+func relativeTo(manifestDir, path string) string {
+	if manifestDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(manifestDir, path)
+}
+
+func parseDuration(serviceName, field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("Service %s has an invalid %s of \"%s\". Use a duration such as 90s, 10m or 1h", serviceName, field, value)
+	}
+	return duration, nil
 }
 
 // ServiceManifest describes a service Manifest as an array of services
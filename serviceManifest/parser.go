@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"path/filepath"
 )
 
 // ParserInterface is an interface describing the default methods used to decode a manifest file
@@ -15,10 +16,11 @@ type ParserInterface interface {
 // ParseData holds the Parser reader and the interface that will provide the methods to process the
 // input data
 type ParseData struct {
-	Parser  ParserInterface
-	Reader  io.Reader
-	Decoder DecoderInterface
-	FileIO  FileIOInterface
+	Parser   ParserInterface
+	Reader   io.Reader
+	Decoder  DecoderInterface
+	FileIO   FileIOInterface
+	Filename string // The file being parsed, which problems found in the manifest are reported against
 }
 
 // NewParser returns a ParseData structure with the default interfaces described in its struct
@@ -45,15 +47,25 @@ func (p *ParseData) CreateParser(filename string) (*ParseData, error) {
 
 	p.Parser = p
 	p.Reader = reader
+	p.Filename = filename
 	return p, err
 }
 
-// Parse parses a manifest from a reader
+// Parse parses a manifest from a reader. Files named in the manifest are read relative to the directory of the
+// manifest file.
 func (p *ParseData) Parse(varsFilePaths []string, vars map[string]string) (*ServiceManifest, error) {
 	bytes, err := ioutil.ReadAll(p.Reader)
 	if err != nil {
 		return nil, err
 	}
 
-	return p.Decoder.DecodeManifest(bytes, varsFilePaths, vars)
+	manifestDir := ""
+	if p.Filename != "" {
+		manifestDir = filepath.Dir(p.Filename)
+	}
+	manifest, err := p.Decoder.DecodeManifest(bytes, manifestDir, varsFilePaths, vars)
+	if validationErr, isValidationErr := err.(*ValidationError); isValidationErr {
+		validationErr.Filename = p.Filename
+	}
+	return manifest, err
 }
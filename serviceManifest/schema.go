@@ -0,0 +1,493 @@
+package serviceManifest
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// ValidationError lists every problem found in a services manifest, so that they can all be fixed at once
+type ValidationError struct {
+	Filename string
+	Problems []ValidationProblem
+}
+
+// ValidationProblem is a single problem in a services manifest, along with where it was found
+type ValidationProblem struct {
+	Line    int // Starts at 1. 0 when the position is unknown.
+	Column  int // Starts at 1. 0 when the position is unknown.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	manifestName := "services manifest"
+	if e.Filename != "" {
+		manifestName = "services manifest " + e.Filename
+	}
+
+	lines := []string{fmt.Sprintf("The %s is invalid:", manifestName)}
+	for _, problem := range e.Problems {
+		lines = append(lines, "  "+problem.location(e.Filename)+problem.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p ValidationProblem) location(filename string) string {
+	switch {
+	case p.Line == 0 && filename != "":
+		return filename + ": "
+	case p.Line == 0:
+		return ""
+	case filename != "":
+		return fmt.Sprintf("%s:%d:%d: ", filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("line %d, column %d: ", p.Line, p.Column)
+}
+
+// serviceTypes are the supported types of service. A blank type is a brokered service.
+var serviceTypes = []string{"brokered", "credentials", "drain", "route"}
+
+// onFailurePolicies are the supported onFailure policies of a brokered service. A blank policy is fail.
+var onFailurePolicies = []string{"fail", "recreate", "ignore"}
+
+// brokeredKeys are the keys that only brokered services support
+var brokeredKeys = []string{"onFailure", "service-keys", "share-to", "unshare-unlisted"}
+
+// validateSchema checks the evaluated services manifest for unknown keys, values of the wrong kind or that aren't
+// supported, missing required fields and duplicate service names. Problems are located in the manifest as it was written, since evaluating its
+// variables reformats it. A manifest that isn't valid YAML is left for the decoder to report.
+func validateSchema(written, evaluated []byte) error {
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(evaluated, &document); err != nil {
+		return nil
+	}
+
+	v := &schemaValidator{positions: locatePositions(written), names: map[string]position{}}
+	for _, item := range document {
+		key := fmt.Sprintf("%v", item.Key)
+		if key != "create-services" {
+			v.unknownKey(v.positions.topLevel[key], key, "in the services manifest", []string{"create-services"})
+			continue
+		}
+
+		services, isList := item.Value.([]interface{})
+		if !isList {
+			if item.Value != nil {
+				v.add(v.positions.topLevel[key], "create-services must be a list of services")
+			}
+			continue
+		}
+		for index, service := range services {
+			v.validateService(index, service)
+		}
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		return v.problems[i].Line < v.problems[j].Line ||
+			(v.problems[i].Line == v.problems[j].Line && v.problems[i].Column < v.problems[j].Column)
+	})
+	return &ValidationError{Problems: v.problems}
+}
+
+type schemaValidator struct {
+	positions manifestPositions
+	problems  []ValidationProblem
+	names     map[string]position // The position of each service name seen so far
+}
+
+func (v *schemaValidator) add(at position, format string, args ...interface{}) {
+	v.problems = append(v.problems, ValidationProblem{Line: at.line, Column: at.column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) unknownKey(at position, key, where string, knownKeys []string) {
+	message := fmt.Sprintf("unknown key \"%s\" %s", key, where)
+	if suggestion := ClosestMatch(key, knownKeys); suggestion != "" {
+		message += fmt.Sprintf(". Did you mean \"%s\"?", suggestion)
+	}
+	v.add(at, "%s", message)
+}
+
+func (v *schemaValidator) validateService(index int, value interface{}) {
+	servicePositions := v.positions.service(index)
+	fields, isMap := toFields(value)
+	if !isMap {
+		v.add(servicePositions.start, "service #%d must be a map of keys to values", index+1)
+		return
+	}
+
+	description := fmt.Sprintf("service #%d", index+1)
+	if name, isString := fields["name"].(string); isString && name != "" {
+		description = "service " + name
+	}
+	v.validateFields(reflect.TypeOf(Service{}), value, description, servicePositions.key)
+
+	serviceType, _ := fields["type"].(string)
+	state, _ := fields["state"].(string)
+	if name, isString := fields["name"].(string); !isString || name == "" {
+		v.add(servicePositions.start, "%s is missing name", description)
+	} else if first, used := v.names[name]; used {
+		message := fmt.Sprintf("service name %s is used more than once", name)
+		if first.line > 0 {
+			message += fmt.Sprintf(". It was first used on line %d", first.line)
+		}
+		v.add(servicePositions.key("name"), "%s", message)
+	} else {
+		v.names[name] = servicePositions.key("name")
+	}
+
+	if state != "" && state != "present" && state != "absent" {
+		v.add(servicePositions.key("state"), "%s has an unsupported state \"%s\". Use present or absent", description, state)
+	}
+	if serviceType != "" && !contains(serviceTypes, serviceType) {
+		v.add(servicePositions.key("type"), "%s has an unsupported type \"%s\". Use %s", description, serviceType, strings.Join(serviceTypes, ", "))
+		return
+	}
+	v.validateSettings(fields, serviceType, description, servicePositions)
+	// A service that is being deleted only needs its name
+	if state == "absent" {
+		return
+	}
+
+	missing := func(key string) bool {
+		return !isSet(fields[key])
+	}
+	switch serviceType {
+	case "", "brokered":
+		for _, key := range []string{"broker", "plan"} {
+			if missing(key) {
+				v.add(servicePositions.start, "%s is a brokered service, but is missing %s", description, key)
+			}
+		}
+	case "credentials":
+		if missing("credentials") && missing("credentials-file") {
+			v.add(servicePositions.start, "%s is a credentials service, but is missing credentials or credentials-file", description)
+		}
+	case "drain":
+		if missing("url") {
+			v.add(servicePositions.start, "%s is a drain service, but is missing url", description)
+		}
+	case "route":
+		if missing("url") {
+			v.add(servicePositions.start, "%s is a route service, but is missing url", description)
+		} else if routeURL, isString := fields["url"].(string); isString {
+			if parsedURL, err := url.Parse(routeURL); err != nil || strings.ToLower(parsedURL.Scheme) != "https" {
+				v.add(servicePositions.key("url"), "%s is a route service, but its url \"%s\" does not use https", description, routeURL)
+			}
+		}
+	}
+}
+
+// validateSettings checks the values of the settings of a service, and that the service's type supports them
+func (v *schemaValidator) validateSettings(fields map[string]interface{}, serviceType, description string, at servicePositions) {
+	if serviceType != "" && serviceType != "brokered" {
+		for _, key := range brokeredKeys {
+			if isSet(fields[key]) {
+				v.add(at.key(key), "%s has %s, which only brokered services support", description, key)
+			}
+		}
+	}
+	if isSet(fields["credentials-file"]) && serviceType != "credentials" {
+		v.add(at.key("credentials-file"), "%s has a credentials-file, which is only supported by credentials services", description)
+	}
+
+	if onFailure, isString := fields["onFailure"].(string); isString && onFailure != "" && !contains(onFailurePolicies, onFailure) {
+		v.add(at.key("onFailure"), "%s has an unsupported onFailure \"%s\". Use %s", description, onFailure, strings.Join(onFailurePolicies, ", "))
+	}
+	if targets, isList := fields["share-to"].([]interface{}); isList {
+		for _, target := range targets {
+			if !isScalar(target) {
+				continue
+			}
+			if parts := strings.Split(fmt.Sprintf("%v", target), "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				v.add(at.key("share-to"), "%s has a share-to target \"%v\". Targets must be of the form org/space", description, target)
+			}
+		}
+	}
+	if retries, isInt := fields["retries"].(int); isInt && retries < 0 {
+		v.add(at.key("retries"), "%s has a negative number of retries. Use 0 or more", description)
+	}
+	for _, key := range []string{"timeout", "pollInterval"} {
+		if value := fields[key]; value != nil && isScalar(value) {
+			if _, err := parseDuration("", key, fmt.Sprintf("%v", value)); err != nil {
+				v.add(at.key(key), "%s has an invalid %s \"%v\". Use a duration such as 90s, 10m or 1h", description, key, value)
+			}
+		}
+	}
+}
+
+// validateFields checks the keys of a map, and the kind of their values, against the yaml fields of a struct
+func (v *schemaValidator) validateFields(structType reflect.Type, value interface{}, description string, at func(key string) position) {
+	knownFields := yamlFields(structType)
+	knownKeys := []string{}
+	for key := range knownFields {
+		knownKeys = append(knownKeys, key)
+	}
+	sort.Strings(knownKeys)
+
+	for _, item := range toItems(value) {
+		key := fmt.Sprintf("%v", item.Key)
+		fieldType, known := knownFields[key]
+		if !known {
+			v.unknownKey(at(key), key, "in "+description, knownKeys)
+			continue
+		}
+		if item.Value == nil {
+			continue
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Bool:
+			if _, isBool := item.Value.(bool); !isBool {
+				v.add(at(key), "%s of %s must be true or false", key, description)
+			}
+		case reflect.Int:
+			if _, isInt := item.Value.(int); !isInt {
+				v.add(at(key), "%s of %s must be a whole number", key, description)
+			}
+		case reflect.String:
+			if !isScalar(item.Value) {
+				v.add(at(key), "%s of %s must be a string", key, description)
+			}
+		case reflect.Slice:
+			elements, isList := item.Value.([]interface{})
+			if !isList {
+				v.add(at(key), "%s of %s must be a list", key, description)
+				continue
+			}
+			for index, element := range elements {
+				if fieldType.Elem().Kind() == reflect.Struct {
+					// Nested entries, such as service keys, are located by the key of their list
+					elementDescription := fmt.Sprintf("%s #%d of %s", key, index+1, description)
+					if _, isMap := toFields(element); !isMap {
+						v.add(at(key), "%s must be a map of keys to values", elementDescription)
+						continue
+					}
+					v.validateFields(fieldType.Elem(), element, elementDescription, func(string) position { return at(key) })
+				} else if !isScalar(element) {
+					v.add(at(key), "%s of %s must be a list of strings", key, description)
+					break
+				}
+			}
+		case reflect.Map:
+			entries, isMap := toFields(item.Value)
+			if !isMap {
+				v.add(at(key), "%s of %s must be a map of keys to values", key, description)
+				continue
+			}
+			for _, entry := range entries {
+				if !isScalar(entry) {
+					v.add(at(key), "%s of %s must be a map of keys to strings", key, description)
+					break
+				}
+			}
+		}
+	}
+}
+
+// yamlFields returns the type of each field of a struct by its yaml key
+func yamlFields(structType reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key != "" && key != "-" {
+			fields[key] = field.Type
+		}
+	}
+	return fields
+}
+
+// toItems returns the keys and values of a map, in the order they were written if known
+func toItems(value interface{}) yaml.MapSlice {
+	switch typedValue := value.(type) {
+	case yaml.MapSlice:
+		return typedValue
+	case map[interface{}]interface{}:
+		items := yaml.MapSlice{}
+		for key, value := range typedValue {
+			items = append(items, yaml.MapItem{Key: key, Value: value})
+		}
+		sort.SliceStable(items, func(i, j int) bool { return fmt.Sprintf("%v", items[i].Key) < fmt.Sprintf("%v", items[j].Key) })
+		return items
+	}
+	return nil
+}
+
+// toFields returns the values of a map by key, and whether the value is a map at all
+func toFields(value interface{}) (map[string]interface{}, bool) {
+	switch value.(type) {
+	case yaml.MapSlice, map[interface{}]interface{}:
+	default:
+		return nil, false
+	}
+
+	fields := map[string]interface{}{}
+	for _, item := range toItems(value) {
+		fields[fmt.Sprintf("%v", item.Key)] = item.Value
+	}
+	return fields, true
+}
+
+// isSet reports whether a value has been given, rather than left blank, false or empty
+func isSet(value interface{}) bool {
+	switch typedValue := value.(type) {
+	case nil:
+		return false
+	case string:
+		return typedValue != ""
+	case bool:
+		return typedValue
+	case []interface{}:
+		return len(typedValue) > 0
+	}
+	return true
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case yaml.MapSlice, map[interface{}]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosestMatch returns the candidate that is the closest match to a misspelt name, or blank if none is close enough.
+// Case is ignored, and up to 2 edits are considered a close match.
+func ClosestMatch(name string, candidates []string) string {
+	closest := ""
+	closestDistance := 3 // Only up to 2 edits are considered a close match
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance < closestDistance {
+			closest = candidate
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+// editDistance returns the number of single character insertions, deletions or substitutions between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minimum(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minimum(values ...int) int {
+	smallest := values[0]
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+	return smallest
+}
+
+// position is a line and column, both starting at 1, in the services manifest
+type position struct {
+	line   int
+	column int
+}
+
+// manifestPositions are the positions of the top level keys, and of each service and its keys, in a services manifest
+type manifestPositions struct {
+	topLevel map[string]position
+	services []servicePositions
+}
+
+type servicePositions struct {
+	start position
+	keys  map[string]position
+}
+
+// service returns the positions of a service. A service that couldn't be located has no position.
+func (p manifestPositions) service(index int) servicePositions {
+	if index < len(p.services) {
+		return p.services[index]
+	}
+	return servicePositions{keys: map[string]position{}}
+}
+
+// key returns the position of a key of the service, or the start of the service if the key couldn't be located
+func (s servicePositions) key(key string) position {
+	if at, exists := s.keys[key]; exists {
+		return at
+	}
+	return s.start
+}
+
+// locatePositions finds the top level keys, and each service and its keys, in the services manifest as it was written.
+// Since that is before its variables are evaluated, a service or key that comes from a variable is located at the
+// variable. A manifest that isn't valid YAML as written has no positions.
+func locatePositions(bytes []byte) manifestPositions {
+	positions := manifestPositions{topLevel: map[string]position{}}
+
+	var document yaml3.Node
+	if err := yaml3.Unmarshal(bytes, &document); err != nil || len(document.Content) == 0 {
+		return positions
+	}
+	root := document.Content[0]
+	if root.Kind != yaml3.MappingNode {
+		return positions
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if _, exists := positions.topLevel[key.Value]; exists {
+			continue
+		}
+		positions.topLevel[key.Value] = positionOf(key)
+		if key.Value != "create-services" || value.Kind != yaml3.SequenceNode {
+			continue
+		}
+
+		for _, item := range value.Content {
+			service := servicePositions{start: positionOf(item), keys: map[string]position{}}
+			if item.Kind == yaml3.MappingNode {
+				for j := 0; j+1 < len(item.Content); j += 2 {
+					if _, exists := service.keys[item.Content[j].Value]; !exists {
+						service.keys[item.Content[j].Value] = positionOf(item.Content[j])
+					}
+				}
+			}
+			positions.services = append(positions.services, service)
+		}
+	}
+	return positions
+}
+
+func positionOf(node *yaml3.Node) position {
+	return position{line: node.Line, column: node.Column}
+}
@@ -3,6 +3,10 @@ package serviceManifest_test
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -56,4 +60,254 @@ var _ = Describe("ServiceManifest", func() {
 		Expect(manifest.Services[0].ServiceName).Should(Equal("Test"))
 
 	})
+
+	It("SortByDependencies should keep the manifest order when there are no dependencies", func() {
+		manifest := &ServiceManifest{Services: []Service{
+			{ServiceName: "a"}, {ServiceName: "b"}, {ServiceName: "c"},
+		}}
+		sorted, err := manifest.SortByDependencies()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sorted).Should(Equal(manifest.Services))
+	})
+
+	It("SortByDependencies should place dependencies before the services that depend on them", func() {
+		manifest := &ServiceManifest{Services: []Service{
+			{ServiceName: "a", DependsOn: []string{"c"}},
+			{ServiceName: "b"},
+			{ServiceName: "c", DependsOn: []string{"b"}},
+		}}
+		sorted, err := manifest.SortByDependencies()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect([]string{sorted[0].ServiceName, sorted[1].ServiceName, sorted[2].ServiceName}).Should(Equal([]string{"b", "c", "a"}))
+	})
+
+	It("SortByDependencies should fail on an unknown dependency or a cycle", func() {
+		manifest := &ServiceManifest{Services: []Service{
+			{ServiceName: "a", DependsOn: []string{"unknown"}},
+		}}
+		_, err := manifest.SortByDependencies()
+		Expect(err).Should(MatchError("Service a depends on unknown, which is not in the services manifest"))
+
+		manifest = &ServiceManifest{Services: []Service{
+			{ServiceName: "a", DependsOn: []string{"a"}},
+		}}
+		_, err = manifest.SortByDependencies()
+		Expect(err).Should(MatchError("Dependency cycle detected between services: a -> a"))
+	})
+
+	It("A service should return its timeout and poll interval as durations", func() {
+		service := Service{ServiceName: "a", Timeout: "30m", PollInterval: "10s"}
+		timeout, err := service.TimeoutDuration()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(timeout).Should(Equal(30 * time.Minute))
+
+		interval, err := service.PollIntervalDuration()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(interval).Should(Equal(10 * time.Second))
+
+		timeout, err = Service{ServiceName: "a"}.TimeoutDuration()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(timeout).Should(BeZero())
+
+		_, err = Service{ServiceName: "a", PollInterval: "often"}.PollIntervalDuration()
+		Expect(err).Should(MatchError("Service a has an invalid pollInterval of \"often\". Use a duration such as 90s, 10m or 1h"))
+	})
+
+	It("SortByDependencies should fail when a service depends on one marked absent", func() {
+		manifest := &ServiceManifest{Services: []Service{
+			{ServiceName: "a", State: "absent"},
+			{ServiceName: "b", DependsOn: []string{"a"}},
+		}}
+		_, err := manifest.SortByDependencies()
+		Expect(err).Should(MatchError("Service b depends on a, which is marked absent"))
+	})
+
+	It("ResolveParameters should not allow both parameters and a parameters-file", func() {
+		service := Service{ServiceName: "a", Parameters: "{}", ParametersFile: "params.json"}
+		Expect(service.ResolveParameters("")).Should(HaveOccurred())
+	})
+
+	It("ResolveParameters should fail on a missing parameters-file", func() {
+		service := Service{ServiceName: "a", ParametersFile: "./somewhere-in-the-universe.json"}
+		Expect(service.ResolveParameters("")).Should(HaveOccurred())
+	})
+
+	It("ResolveParameters should read a relative parameters-file from the manifest directory, and an absolute one as it is", func() {
+		manifestDir, err := ioutil.TempDir("", "csp-manifest")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(manifestDir)
+		Expect(ioutil.WriteFile(filepath.Join(manifestDir, "params.yml"), []byte("size: 2\n"), 0644)).Should(Succeed())
+
+		service := Service{ServiceName: "a", ParametersFile: "params.yml"}
+		Expect(service.ResolveParameters(manifestDir)).Should(Succeed())
+		Expect(service.JSONParameters).Should(MatchJSON("{\"size\":2}"))
+
+		service = Service{ServiceName: "a", ParametersFile: filepath.Join(manifestDir, "params.yml")}
+		Expect(service.ResolveParameters("somewhere-else")).Should(Succeed())
+		Expect(service.JSONParameters).Should(MatchJSON("{\"size\":2}"))
+	})
+
+	It("ResolveParameters should keep string parameters as they are", func() {
+		service := Service{ServiceName: "a", Parameters: "{\"RAM\": \"4gb\" }"}
+		Expect(service.ResolveParameters("")).ShouldNot(HaveOccurred())
+		Expect(service.JSONParameters).Should(Equal("{\"RAM\": \"4gb\" }"))
+	})
+
+	It("ResolveParameters should fail on string parameters that are not valid JSON", func() {
+		service := Service{ServiceName: "a", Parameters: "{\"RAM\": 4gb }"}
+		Expect(service.ResolveParameters("")).Should(MatchError(HavePrefix("The parameters of service a are not valid JSON: ")))
+
+		service = Service{ServiceName: "a", RawBindingParameters: "{bad"}
+		Expect(service.ResolveParameters("")).Should(MatchError(HavePrefix("The binding-parameters of service a are not valid JSON: ")))
+
+		service = Service{ServiceName: "a", ServiceKeys: []ServiceKey{{Name: "k", Parameters: "{bad"}}}
+		Expect(service.ResolveParameters("")).Should(MatchError(HavePrefix("The parameters of service key k of service a are not valid JSON: ")))
+	})
+
+	It("DecodeManifest should convert YAML parameters of service keys and bindings to JSON", func() {
+		manifest := "---\n" +
+			"create-services:\n" +
+			"- name: \"my-database\"\n" +
+			"  broker: \"p-mysql\"\n" +
+			"  plan: \"small\"\n" +
+			"  service-keys:\n" +
+			"  - name: \"reporting\"\n" +
+			"    parameters:\n" +
+			"      role: \"read-only\"\n" +
+			"  bind-to: [\"my-app\"]\n" +
+			"  binding-parameters:\n" +
+			"    permissions: [\"read\", \"write\"]\n"
+
+		serviceManifest, err := NewYmlDecoder().DecodeManifest([]byte(manifest), "", []string{}, map[string]string{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(serviceManifest.Services[0].ServiceKeys[0].JSONParameters).Should(MatchJSON("{\"role\":\"read-only\"}"))
+		Expect(serviceManifest.Services[0].BindingParameters).Should(MatchJSON("{\"permissions\":[\"read\",\"write\"]}"))
+	})
+
+	It("ResolveTags should join a list of tags and keep a string of tags as it is", func() {
+		service := Service{ServiceName: "a", TagList: []interface{}{"mysql", "relational"}}
+		Expect(service.ResolveTags()).ShouldNot(HaveOccurred())
+		Expect(service.Tags).Should(Equal("mysql, relational"))
+
+		service = Service{ServiceName: "a", TagList: "mysql, relational"}
+		Expect(service.ResolveTags()).ShouldNot(HaveOccurred())
+		Expect(service.Tags).Should(Equal("mysql, relational"))
+
+		service = Service{ServiceName: "a", TagList: map[interface{}]interface{}{"mysql": true}}
+		Expect(service.ResolveTags()).Should(HaveOccurred())
+	})
+
+	It("ResolveCredentials should not allow both credentials and a credentials-file", func() {
+		service := Service{ServiceName: "a", Credentials: map[interface{}]interface{}{"uri": "x"}, CredentialsFile: "credentials.json"}
+		Expect(service.ResolveCredentials("")).Should(HaveOccurred())
+	})
+
+	It("ResolveCredentials should only accept a map of credentials", func() {
+		service := Service{ServiceName: "a", Credentials: []interface{}{"uri"}}
+		Expect(service.ResolveCredentials("")).Should(HaveOccurred())
+	})
+
+	It("DecodeManifest should locate schema problems in the manifest as it was written, before its variables are evaluated", func() {
+		manifest := "---\n" +
+			"create-services:\n" +
+			"  - name: \"((env))-route\"\n" +
+			"    type: \"route\"\n" +
+			"    url:  \"((url))\"\n" +
+			"    tgas: \"router\"\n"
+
+		_, err := NewYmlDecoder().DecodeManifest([]byte(manifest), "", []string{}, map[string]string{"env": "dev", "url": "https://example.com"})
+		Expect(err).Should(MatchError("The services manifest is invalid:\n" +
+			"  line 6, column 5: unknown key \"tgas\" in service dev-route. Did you mean \"tags\"?"))
+	})
+
+	It("DecodeManifest should require the fields of each type of service", func() {
+		manifest := "---\n" +
+			"create-services:\n" +
+			"- name: \"my-credentials\"\n" +
+			"  type: \"credentials\"\n" +
+			"- name: \"my-drain\"\n" +
+			"  type: \"drain\"\n" +
+			"- name: \"my-old-database\"\n" +
+			"  state: \"absent\"\n" +
+			"- type: \"route\"\n" +
+			"  url: \"https://example.com\"\n"
+
+		_, err := NewYmlDecoder().DecodeManifest([]byte(manifest), "", []string{}, map[string]string{})
+		Expect(err).Should(MatchError("The services manifest is invalid:\n" +
+			"  line 3, column 3: service my-credentials is a credentials service, but is missing credentials or credentials-file\n" +
+			"  line 5, column 3: service my-drain is a drain service, but is missing url\n" +
+			"  line 9, column 3: service #4 is missing name"))
+	})
+
+	It("DecodeManifest should report unsupported settings along with the other schema problems", func() {
+		manifest := "---\n" +
+			"create-services:\n" +
+			"- name: \"my-database\"\n" +
+			"  broker: \"p-mysql\"\n" +
+			"  plan: \"1gb\"\n" +
+			"  state: \"gone\"\n" +
+			"  retries: -1\n" +
+			"  timeout: \"soon\"\n" +
+			"  pollInterval: \"10s\"\n" +
+			"  credentials-file: \"credentials.yml\"\n" +
+			"- name: \"my-config\"\n" +
+			"  type: \"credentials\"\n" +
+			"  credentials: {uri: \"https://config.example.com\"}\n" +
+			"  service-keys:\n" +
+			"  - name: \"reporting\"\n" +
+			"  share-to:\n" +
+			"  - \"team-a/dev\"\n" +
+			"- name: \"my-cache\"\n" +
+			"  broker: \"p-redis\"\n" +
+			"  plan: \"shared\"\n" +
+			"  share-to: [\"team-a\"]\n" +
+			"  bogus: true\n"
+
+		_, err := NewYmlDecoder().DecodeManifest([]byte(manifest), "", []string{}, map[string]string{})
+		Expect(err).Should(MatchError("The services manifest is invalid:\n" +
+			"  line 6, column 3: service my-database has an unsupported state \"gone\". Use present or absent\n" +
+			"  line 7, column 3: service my-database has a negative number of retries. Use 0 or more\n" +
+			"  line 8, column 3: service my-database has an invalid timeout \"soon\". Use a duration such as 90s, 10m or 1h\n" +
+			"  line 10, column 3: service my-database has a credentials-file, which is only supported by credentials services\n" +
+			"  line 14, column 3: service my-config has service-keys, which only brokered services support\n" +
+			"  line 16, column 3: service my-config has share-to, which only brokered services support\n" +
+			"  line 21, column 3: service my-cache has a share-to target \"team-a\". Targets must be of the form org/space\n" +
+			"  line 22, column 3: unknown key \"bogus\" in service my-cache"))
+	})
+
+	It("DecodeManifest should locate schema problems in services written in flow style", func() {
+		manifest := "---\n" +
+			"create-services: [\n" +
+			"  {name: \"my-database\", broker: \"p-mysql\", plna: \"1gb\"},\n" +
+			"  {name: \"my-cache\",\n" +
+			"   type: \"credential\"}]\n"
+
+		_, err := NewYmlDecoder().DecodeManifest([]byte(manifest), "", []string{}, map[string]string{})
+		Expect(err).Should(MatchError("The services manifest is invalid:\n" +
+			"  line 3, column 3: service my-database is a brokered service, but is missing plan\n" +
+			"  line 3, column 44: unknown key \"plna\" in service my-database. Did you mean \"plan\"?\n" +
+			"  line 5, column 4: service my-cache has an unsupported type \"credential\". Use brokered, credentials, drain, route"))
+	})
+
+	It("DecodeManifest should accept labels and annotations that map keys to strings", func() {
+		manifest := "---\n" +
+			"create-services:\n" +
+			"- name: \"my-database\"\n" +
+			"  broker: \"p-mysql\"\n" +
+			"  plan: \"small\"\n" +
+			"  labels:\n" +
+			"    team: \"payments\"\n" +
+			"  annotations:\n" +
+			"    - \"contact\"\n"
+
+		_, err := NewYmlDecoder().DecodeManifest([]byte(manifest), "", []string{}, map[string]string{})
+		Expect(err).Should(MatchError("The services manifest is invalid:\n" +
+			"  line 8, column 3: annotations of service my-database must be a map of keys to values"))
+
+		manifest = strings.Replace(manifest, "    - \"contact\"\n", "    contact: \"payments@example.com\"\n", 1)
+		serviceManifest, err := NewYmlDecoder().DecodeManifest([]byte(manifest), "", []string{}, map[string]string{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(serviceManifest.Services[0].Labels).Should(Equal(map[string]string{"team": "payments"}))
+		Expect(serviceManifest.Services[0].Annotations).Should(Equal(map[string]string{"contact": "payments@example.com"}))
+	})
 })
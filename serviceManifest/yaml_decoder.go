@@ -8,9 +8,10 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-// DecoderInterface describes the method needed to decode a bytestream to a ServiceManifest
+// DecoderInterface describes the method needed to decode a bytestream to a ServiceManifest. Files named in the
+// manifest are relative to manifestDir, the directory of the manifest file.
 type DecoderInterface interface {
-	DecodeManifest(bytes []byte, varsFilePaths []string, vars map[string]string) (*ServiceManifest, error)
+	DecodeManifest(bytes []byte, manifestDir string, varsFilePaths []string, vars map[string]string) (*ServiceManifest, error)
 }
 
 // YmlDecoder is
@@ -24,7 +25,7 @@ func NewYmlDecoder() *YmlDecoder {
 
 // DecodeManifest unmarshals a bytestream into a ServiceManifest struct using yaml.v2
 // In addition, it will also evaluate any templated variables that are specified in the input service manifest yaml
-func (yml *YmlDecoder) DecodeManifest(bytes []byte, varsFilePaths []string, vars map[string]string) (*ServiceManifest, error) {
+func (yml *YmlDecoder) DecodeManifest(bytes []byte, manifestDir string, varsFilePaths []string, vars map[string]string) (*ServiceManifest, error) {
 	var m ServiceManifest
 	var err error
 
@@ -53,15 +54,39 @@ func (yml *YmlDecoder) DecodeManifest(bytes []byte, varsFilePaths []string, vars
 		yamlVars[key] = value
 	}
 
-	bytes, err = tpl.Evaluate(yamlVars, nil, template.EvaluateOpts{ExpectAllKeys: true})
+	evaluatedBytes, err := tpl.Evaluate(yamlVars, nil, template.EvaluateOpts{ExpectAllKeys: true})
 	if err != nil {
 		return nil, fmt.Errorf("Error while trying to evaluate vars in service manifest: %s", err)
 	}
 
+	// Every problem with the structure of the manifest is reported at once, before anything else is checked
+	if err = validateSchema(bytes, evaluatedBytes); err != nil {
+		return nil, err
+	}
+	bytes = evaluatedBytes
+
 	err = yaml.Unmarshal(bytes, &m)
 	if err != nil {
 		return nil, err
 	}
 
+	for idx := range m.Services {
+		service := &m.Services[idx]
+		if err = service.ResolveParameters(manifestDir); err != nil {
+			return nil, err
+		}
+		if err = service.ResolveTags(); err != nil {
+			return nil, err
+		}
+		if err = service.ResolveCredentials(manifestDir); err != nil {
+			return nil, err
+		}
+	}
+
+	// Catch missing dependencies and cycles before any service is created
+	if _, err = m.SortByDependencies(); err != nil {
+		return nil, err
+	}
+
 	return &m, err
 }